@@ -1,9 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 )
 
@@ -11,43 +15,144 @@ import (
 var version string = "--"
 var goldmarkVersion string = "--"
 
-// printError acts only is error is present:
-// - print the error message
-// - panic if necessary
-func printError(fatal bool, e error, m ...interface{}) {
-	if e != nil {
-		if len(m) > 0 {
-			fmt.Fprint(os.Stderr, "Error: ")
-			fmt.Fprintln(os.Stderr, m...)
-		} else {
-			fmt.Fprintln(os.Stderr, "Error.")
-		}
-		fmt.Fprintln(os.Stderr, e)
-		if fatal {
-			panic(e)
-		}
+// printMutex prevents the messages printed from concurrent builds to be interleaved
+var printMutex sync.Mutex
+
+// the exit status codes
+const (
+	exitOK      = 0 // everything was done
+	exitFailure = 1 // the command failed (or the check found problems)
+	exitUsage   = 2 // the flags or the parameters are wrong
+	exitPartial = 3 // some files failed, the others were done (with --keep-going)
+)
+
+// failure is an error with the message explaining what failed.
+type failure struct {
+	message string
+	err     error
+}
+
+// Error implements error.
+func (f *failure) Error() string {
+	return f.message + " " + f.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// fail returns the error e with the message m, or nil if there is no error.
+func fail(e error, m ...interface{}) error {
+	if e == nil {
+		return nil
 	}
+	return &failure{message: strings.TrimSuffix(fmt.Sprintln(m...), "\n"), err: e}
 }
 
-// check print the error message and panic if there is an error
-func check(e error, m ...interface{}) {
-	printError(true, e, m...)
+// usageError is an error in the flags or the parameters.
+type usageError struct {
+	err error
 }
 
-// check print the error message (no panic) if there is an error
-func try(e error, m ...interface{}) {
-	printError(false, e, m...)
+// Error implements error.
+func (e *usageError) Error() string {
+	return e.err.Error()
 }
 
-// end is the last function executed in this program.
-func mainEnd() {
-	// in case of error return status is 1
-	if r := recover(); r != nil {
-		os.Exit(1)
+// Unwrap returns the wrapped error.
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// usage marks the error e (if any) as a flags or parameters error.
+func usage(e error) error {
+	if e == nil {
+		return nil
 	}
+	return &usageError{err: e}
+}
 
-	// the normal return status is 0
-	os.Exit(0)
+// partialError reports the files that failed, when the other ones were done.
+type partialError struct {
+	failed map[string]error
+	total  int
+}
+
+// Error implements error.
+func (e *partialError) Error() string {
+	return fmt.Sprintf("%d of %d file(s) failed", len(e.failed), e.total)
+}
+
+// summary prints the failed files and their errors.
+func (e *partialError) summary() {
+	files := make([]string, 0, len(e.failed))
+	for file := range e.failed {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	printMutex.Lock()
+	defer printMutex.Unlock()
+	fmt.Fprintln(os.Stderr, "Failed files:")
+	for _, file := range files {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", file, e.failed[file])
+	}
+}
+
+// exitCode returns the exit status corresponding to the error.
+func exitCode(err error) int {
+	var uerr *usageError
+	var perr *partialError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &uerr):
+		return exitUsage
+	case errors.As(err, &perr) && len(perr.failed) < perr.total:
+		return exitPartial
+	default:
+		return exitFailure
+	}
+}
+
+// printError acts only is error is present:
+// print the error message m (if any) followed by the error.
+// The message of a failure is used if m is empty.
+func printError(e error, m ...interface{}) {
+	if e == nil {
+		return
+	}
+	if u, ok := e.(*usageError); ok {
+		e = u.err
+	}
+	if f, ok := e.(*failure); ok && len(m) == 0 {
+		m, e = []interface{}{f.message}, f.err
+	}
+	var perr *partialError
+	if errors.As(e, &perr) && len(perr.failed) > 0 {
+		perr.summary()
+	}
+	printMutex.Lock()
+	defer printMutex.Unlock()
+	if len(m) > 0 {
+		fmt.Fprint(os.Stderr, "Error: ")
+		fmt.Fprintln(os.Stderr, m...)
+	} else {
+		fmt.Fprintln(os.Stderr, "Error.")
+	}
+	fmt.Fprintln(os.Stderr, e)
+}
+
+// try print the error message if there is an error
+func try(e error, m ...interface{}) {
+	printError(e, m...)
+}
+
+// mainEnd is the last function executed in this program:
+// it prints the error (if any) and exits with the corresponding status.
+func mainEnd(err error) {
+	printError(err)
+	os.Exit(exitCode(err))
 }
 
 // If we terminate with Ctrl/Cmd-C we call end()
@@ -57,25 +162,41 @@ func catchCtrlC() {
 	go func() {
 		<-c
 		info("Bye.\n")
-		mainEnd()
+		mainEnd(nil)
 	}()
 }
 
 // main is the entry point
 func main() {
-
-	// error handling
-	defer mainEnd()
 	// interrupt handling
 	catchCtrlC()
 
+	mainEnd(run())
+}
+
+// run checks the flags and executes the command.
+func run() error {
 	// check the flags and initialize the parser
-	SetParameters()
+	if err := SetParameters(); err != nil {
+		return err
+	}
 
-	// serve or build ?
-	if serve {
-		serveFiles()
-	} else {
-		buildFiles()
+	// check, feed, api, serve or build ?
+	switch {
+	case command == "check":
+		return checkFiles()
+	case command == "feed":
+		return feedFiles()
+	case command == "api":
+		return apiFiles()
+	case serve:
+		return serveFiles()
+	}
+	err := buildFiles()
+	if watch && (err == nil || keepGoing) {
+		// with --keep-going the failed files are rebuilt when changed
+		try(err)
+		return watchFiles()
 	}
+	return err
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kpym/gm/render"
+)
+
+// apiMaxBody is the maximal size of a request body (10 MB)
+const apiMaxBody = 10 << 20
+
+// apiMaxConverters is the maximal number of cached converters (with non default options)
+const apiMaxConverters = 32
+
+// apiRequest is a document to render: the markdown and the page options.
+// The title and the css are used like the --title and --css flags (the front matter wins).
+type apiRequest struct {
+	Markdown string   `json:"markdown"`
+	Title    string   `json:"title,omitempty"`
+	CSS      []string `json:"css,omitempty"`
+	Fragment bool     `json:"fragment,omitempty"`
+}
+
+// apiResponse is a rendered document of a batch.
+type apiResponse struct {
+	HTML  string `json:"html"`
+	Title string `json:"title,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// apiConverters are the converters for the requested gm-* options
+var apiConverters = struct {
+	converters map[string]*render.Converter
+	mu         sync.Mutex
+}{converters: make(map[string]*render.Converter)}
+
+// boolOption returns the setter of a boolean render option.
+func boolOption(field func(o *render.Options) *bool) func(o *render.Options, value string) error {
+	return func(o *render.Options, value string) (err error) {
+		*field(o), err = strconv.ParseBool(value)
+		return err
+	}
+}
+
+// stringOption returns the setter of a string render option.
+func stringOption(field func(o *render.Options) *string) func(o *render.Options, value string) error {
+	return func(o *render.Options, value string) error {
+		*field(o) = value
+		return nil
+	}
+}
+
+// apiOptions are the gm-* query parameters and the render options they set
+var apiOptions = map[string]func(o *render.Options, value string) error{
+	"gm-attribute":         boolOption(func(o *render.Options) *bool { return &o.Attribute }),
+	"gm-auto-heading-id":   boolOption(func(o *render.Options) *bool { return &o.AutoHeadingID }),
+	"gm-definition-list":   boolOption(func(o *render.Options) *bool { return &o.DefinitionList }),
+	"gm-footnote":          boolOption(func(o *render.Options) *bool { return &o.Footnote }),
+	"gm-footnote-prefix":   stringOption(func(o *render.Options) *string { return &o.FootnotePrefix }),
+	"gm-footnote-backlink": stringOption(func(o *render.Options) *string { return &o.FootnoteBacklink }),
+	"gm-footnote-title":    stringOption(func(o *render.Options) *string { return &o.FootnoteTitle }),
+	"gm-footnote-class":    stringOption(func(o *render.Options) *string { return &o.FootnoteClass }),
+	"gm-linkify":           boolOption(func(o *render.Options) *bool { return &o.Linkify }),
+	"gm-strikethrough":     boolOption(func(o *render.Options) *bool { return &o.Strikethrough }),
+	"gm-table":             boolOption(func(o *render.Options) *bool { return &o.Table }),
+	"gm-task-list":         boolOption(func(o *render.Options) *bool { return &o.TaskList }),
+	"gm-typographer":       boolOption(func(o *render.Options) *bool { return &o.Typographer }),
+	"gm-emoji":             boolOption(func(o *render.Options) *bool { return &o.Emoji }),
+	"gm-unsafe":            boolOption(func(o *render.Options) *bool { return &o.Unsafe }),
+	"gm-math":              boolOption(func(o *render.Options) *bool { return &o.Math }),
+	"gm-sub-sup":           boolOption(func(o *render.Options) *bool { return &o.SubSup }),
+	"gm-mark":              boolOption(func(o *render.Options) *bool { return &o.Mark }),
+	"gm-ins":               boolOption(func(o *render.Options) *bool { return &o.Ins }),
+	"gm-abbr":              boolOption(func(o *render.Options) *bool { return &o.Abbr }),
+	"gm-hard-wraps":        boolOption(func(o *render.Options) *bool { return &o.HardWraps }),
+	"gm-xhtml":             boolOption(func(o *render.Options) *bool { return &o.XHTML }),
+	"gm-highlighting":      stringOption(func(o *render.Options) *string { return &o.Highlighting }),
+	"gm-line-numbers":      boolOption(func(o *render.Options) *bool { return &o.LineNumbers }),
+}
+
+// apiConverter returns the converter for the gm-* options of the query.
+// The options are set over the ones of the command line,
+// but the front matter can't set the template (it would read any file of the server).
+func apiConverter(options map[string]string) (*render.Converter, error) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&key, "%s=%s\n", name, options[name])
+	}
+
+	apiConverters.mu.Lock()
+	defer apiConverters.mu.Unlock()
+	if c, ok := apiConverters.converters[key.String()]; ok {
+		return c, nil
+	}
+	o := currentConverter().Options()
+	o.FrontMatterTemplate = false
+	for _, name := range names {
+		if err := apiOptions[name](&o, options[name]); err != nil {
+			return nil, fmt.Errorf("invalid value %q for %s", options[name], name)
+		}
+	}
+	c, err := render.New(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(apiConverters.converters) >= apiMaxConverters {
+		clear(apiConverters.converters)
+	}
+	apiConverters.converters[key.String()] = c
+	return c, nil
+}
+
+// parseAPIQuery returns the page options and the gm-* options of the query.
+func parseAPIQuery(query url.Values) (req apiRequest, options map[string]string, err error) {
+	options = make(map[string]string)
+	for name, values := range query {
+		value := values[len(values)-1]
+		switch {
+		case name == "title":
+			req.Title = value
+		case name == "css":
+			req.CSS = values
+		case name == "fragment":
+			if req.Fragment, err = strconv.ParseBool(value); err != nil {
+				return req, nil, fmt.Errorf("invalid value %q for fragment", value)
+			}
+		case apiOptions[name] != nil:
+			options[name] = value
+		default:
+			return req, nil, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	return req, options, nil
+}
+
+// renderAPI converts the requested markdown with the converter c.
+// It returns the html (full page or fragment) and the page title.
+func renderAPI(ctx context.Context, c *render.Converter, req apiRequest) (page []byte, pageTitle string, err error) {
+	res, err := c.Convert(ctx, []byte(req.Markdown))
+	if err != nil {
+		return nil, "", err
+	}
+	// the request title and css act like the flags: the front matter wins
+	if res.Meta == nil {
+		res.Meta = make(map[string]any)
+	}
+	if _, ok := res.Meta["title"]; !ok && req.Title != "" {
+		res.Meta["title"] = req.Title
+		res.Title = req.Title
+	}
+	if _, ok := res.Meta["css"]; !ok && len(req.CSS) > 0 {
+		list := make([]any, len(req.CSS))
+		for i, css := range req.CSS {
+			list[i] = css
+		}
+		res.Meta["css"] = list
+	}
+	if req.Fragment {
+		page = []byte(res.HTML)
+	} else if page, err = c.Page(res, nil); err != nil {
+		return nil, "", err
+	}
+	if len(reHtmlRules) > 0 {
+		page = reHtmlRules.Apply(page)
+	}
+	return page, html.UnescapeString(res.Title), nil
+}
+
+// apiError sends the error message with the http status.
+func apiError(w http.ResponseWriter, status int, err error) {
+	info(" error: %s", err)
+	http.Error(w, err.Error(), status)
+}
+
+// readAPIRequest checks the method and returns the request body and query options.
+func readAPIRequest(w http.ResponseWriter, r *http.Request) (body []byte, req apiRequest, c *render.Converter, ok bool) {
+	info("\n%s '%s':", r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		apiError(w, http.StatusMethodNotAllowed, errors.New("only POST is allowed"))
+		return nil, req, nil, false
+	}
+	req, options, err := parseAPIQuery(r.URL.Query())
+	if err == nil {
+		c, err = apiConverter(options)
+	}
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return nil, req, nil, false
+	}
+	body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxBody))
+	if err != nil {
+		apiError(w, http.StatusRequestEntityTooLarge, err)
+		return nil, req, nil, false
+	}
+	return body, req, c, true
+}
+
+// serveRender converts the markdown body to html.
+func serveRender(w http.ResponseWriter, r *http.Request) {
+	body, req, c, ok := readAPIRequest(w, r)
+	if !ok {
+		return
+	}
+	req.Markdown = string(body)
+	page, pageTitle, err := renderAPI(r.Context(), c, req)
+	if err != nil {
+		apiError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	info(" render %d bytes.", len(body))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Gm-Title", url.PathEscape(pageTitle))
+	w.Write(page)
+}
+
+// serveRenderBatch converts the json array of markdown documents.
+// The query options are the defaults of all the documents.
+// The errors are reported for each document.
+func serveRenderBatch(w http.ResponseWriter, r *http.Request) {
+	body, defaults, c, ok := readAPIRequest(w, r)
+	if !ok {
+		return
+	}
+	var reqs []apiRequest
+	if err := json.Unmarshal(body, &reqs); err != nil {
+		apiError(w, http.StatusBadRequest, fmt.Errorf("the body should be a json array of documents: %w", err))
+		return
+	}
+	resps := make([]apiResponse, len(reqs))
+	// the documents are rendered by `jobs` concurrent workers
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, jobs)
+	for i, req := range reqs {
+		if req.Title == "" {
+			req.Title = defaults.Title
+		}
+		if req.CSS == nil {
+			req.CSS = defaults.CSS
+		}
+		req.Fragment = req.Fragment || defaults.Fragment
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, req apiRequest) {
+			defer func() { <-workers; wg.Done() }()
+			page, pageTitle, err := renderAPI(r.Context(), c, req)
+			if err != nil {
+				resps[i].Error = err.Error()
+				return
+			}
+			resps[i] = apiResponse{HTML: string(page), Title: pageTitle}
+		}(i, req)
+	}
+	wg.Wait()
+	info(" render %d document(s).", len(reqs))
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(resps)
+}
+
+// apiFiles starts the render api server.
+// A bad request never stops the server.
+func apiFiles() error {
+	http.HandleFunc("/render", serveRender)
+	http.HandleFunc("/render/batch", serveRenderBatch)
+
+	ln, base, err := listen()
+	if err != nil {
+		return fail(err, "Can't listen on", serveHost)
+	}
+	info("start the render api on %s.\n", ln.Addr())
+	// the machine-parseable line with the url (printed even with --quiet)
+	printMutex.Lock()
+	if ln.Addr().Network() == "unix" {
+		fmt.Printf("GM_SOCKET=%s\n", ln.Addr())
+	}
+	fmt.Printf("GM_URL=%s\n", base)
+	printMutex.Unlock()
+	if useTLS {
+		return fail(http.ServeTLS(ln, nil, certFile, keyFile), "Problem serving on", ln.Addr())
+	}
+	return fail(http.Serve(ln, nil), "Problem serving on", ln.Addr())
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kpym/gm/render"
+)
+
+// apiServer starts a test server with the render api and the cli defaults.
+func apiServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	info = func(string, ...interface{}) {}
+	jobs = 2
+	options := render.DefaultOptions()
+	options.FrontMatterTemplate = true
+	c, err := render.New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converter = c
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", serveRender)
+	mux.HandleFunc("/render/batch", serveRenderBatch)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// apiPost sends the body to the api path and returns the status and the response body.
+func apiPost(t *testing.T, srv *httptest.Server, path, body string) (int, string) {
+	t.Helper()
+	resp, err := http.Post(srv.URL+path, "text/markdown", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+func TestServeRender(t *testing.T) {
+	srv := apiServer(t)
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "page",
+			path:     "/render",
+			body:     "# Hello\n",
+			status:   http.StatusOK,
+			contains: []string{"<title>Hello</title>", `<h1 id="hello">Hello</h1>`},
+		},
+		{
+			name:     "fragment with options",
+			path:     "/render?fragment=true&gm-math=true",
+			body:     "$x$\n",
+			status:   http.StatusOK,
+			contains: []string{`<p><span class="math inline">\(x\)</span></p>`},
+			excludes: []string{"<html"},
+		},
+		{
+			name:     "front matter template ignored",
+			path:     "/render",
+			body:     "---\ntemplate: \"SECRET {{.html}}\"\n---\n# Hello\n",
+			status:   http.StatusOK,
+			contains: []string{"<title>Hello</title>"},
+			excludes: []string{"SECRET"},
+		},
+		{
+			name:   "unknown parameter",
+			path:   "/render?nope=1",
+			body:   "# Hello\n",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid option value",
+			path:   "/render?gm-math=maybe",
+			body:   "# Hello\n",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid front matter",
+			path:   "/render",
+			body:   "+++\ntitle = \n+++\n",
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := apiPost(t, srv, tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.status, body)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("body does not contain %q:\n%s", s, body)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(body, s) {
+					t.Errorf("body contains %q:\n%s", s, body)
+				}
+			}
+		})
+	}
+}
+
+func TestServeRenderMethod(t *testing.T) {
+	srv := apiServer(t)
+	for _, path := range []string{"/render", "/render/batch"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+			t.Errorf("GET %s: status = %d, Allow = %q", path, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	}
+}
+
+func TestServeRenderBatch(t *testing.T) {
+	srv := apiServer(t)
+	docs := []apiRequest{
+		{Markdown: "# One\n"},
+		{Markdown: "+++\ntitle = \n+++\n"},
+		{Markdown: "# Three\n", Title: "Third"},
+	}
+	body, err := json.Marshal(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, content := apiPost(t, srv, "/render/batch?fragment=true", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("status = %d (%s)", status, content)
+	}
+	var resps []apiResponse
+	if err := json.Unmarshal([]byte(content), &resps); err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != len(docs) {
+		t.Fatalf("%d responses, want %d", len(resps), len(docs))
+	}
+	want := []apiResponse{
+		{HTML: "<h1 id=\"one\">One</h1>\n", Title: "One"},
+		{},
+		{HTML: "<h1 id=\"three\">Three</h1>\n", Title: "Third"},
+	}
+	for i, resp := range resps {
+		if i == 1 {
+			if resp.Error == "" || resp.HTML != "" {
+				t.Errorf("response %d = %+v, want an error", i, resp)
+			}
+			continue
+		}
+		if resp != want[i] {
+			t.Errorf("response %d = %+v, want %+v", i, resp, want[i])
+		}
+	}
+
+	if status, _ := apiPost(t, srv, "/render/batch", "not json"); status != http.StatusBadRequest {
+		t.Errorf("invalid json: status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
 
-// buildMd compiles the infile (xxx.md | stdin) to outfile (xxx.html | stdout)
-func buildMd(infile string) {
+// buildMd compiles the infile (xxx.md | stdin) to outfile (xxx.html | stdout).
+// The other local files used by the build are recorded in deps (if not nil).
+func buildMd(infile string, deps *fileDeps) error {
 	// get the dir for link replacement, if any
 	dir := filepath.Dir(infile)
 	// Get the input
@@ -18,8 +22,7 @@ func buildMd(infile string) {
 	if infile != "" {
 		f, err := os.Open(infile)
 		if err != nil {
-			check(err, "Problem opening", infile)
-			return
+			return fmt.Errorf("problem opening %s: %w", infile, err)
 		}
 		defer f.Close()
 		input = f
@@ -30,44 +33,71 @@ func buildMd(infile string) {
 
 	// Read the input
 	markdown, err := io.ReadAll(input)
-	check(err, "Problem reading the markdown.")
-
-	// Apply re-md rules if available
-	if len(reMdRules) > 0 {
-		markdown = reMdRules.Apply(markdown)
+	if err != nil {
+		return fmt.Errorf("problem reading the markdown: %w", err)
 	}
 
 	// compile the input
-	html, err := compile(markdown)
-	check(err, "Problem compiling the markdown.")
+	html, err := buildPage(markdown, dir, site.page(infile), deps)
+	if err != nil {
+		return err
+	}
+
+	// output the result
+	if infile == "" {
+		_, err = os.Stdout.Write(html)
+		return err
+	}
+	outfile := outputName(infile)
+	if err := os.MkdirAll(filepath.Dir(outfile), os.ModePerm); err != nil {
+		return fmt.Errorf("problem to reach/create folder %s: %w", filepath.Dir(outfile), err)
+	}
+	if err := os.WriteFile(outfile, html, 0644); err != nil {
+		return fmt.Errorf("problem modifying %s: %w", outfile, err)
+	}
+	return nil
+}
+
+// buildPage converts the markdown to the final html, the same way for build and serve:
+// the re-md rules, the compilation, the .md links rewriting, the inlining and the re-html rules.
+// The local links are relative to dir.
+// The other local files used by the build are recorded in deps (if not nil).
+func buildPage(markdown []byte, dir string, nav *pageNav, deps *fileDeps) ([]byte, error) {
+	// the re-md rules are applied by the converter
+	html, err := compile(markdown, nav, deps)
+	if err != nil {
+		return nil, fmt.Errorf("problem compiling the markdown: %w", err)
+	}
 	if localmdlinks {
-		html = replaceLinks(html, dir)
+		html = replaceLinks(html, dir, deps)
+	}
+	if selfcont {
+		html, err = selfContain(html, dir, deps)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Apply re-html rules if available
 	if len(reHtmlRules) > 0 {
 		html = reHtmlRules.Apply(html)
 	}
+	return html, nil
+}
 
-	// output the result
-	if infile == "" {
-		os.Stdout.Write(html)
-	} else {
-		var outfile string
+// outputName returns the .html file name corresponding to the .md infile.
+func outputName(infile string) string {
+	return filepath.Join(outdir, htmlName(infile))
+}
 
-		if readme && strings.ToLower(filepath.Base(infile)) == "readme.md" {
-			// if it is a README.md file, we want to name it index.html
-			outfile = filepath.Join(outdir, infile[:len(infile)-9]+"index.html")
-		} else {
-			// otherwise we just change the extension
-			outfile = filepath.Join(outdir, infile[:len(infile)-3]+".html")
-		}
-		if os.MkdirAll(filepath.Dir(outfile), os.ModePerm) != nil {
-			check(err, "Problem to reach/create folder:", filepath.Dir(outfile))
-		}
-		err = os.WriteFile(outfile, html, 0644)
-		check(err, "Problem modifying", outfile)
+// htmlName returns the .html name of the .md file (without the output folder).
+func htmlName(file string) string {
+	if readme && strings.ToLower(filepath.Base(file)) == "readme.md" {
+		// if it is a README.md file, we want to name it index.html
+		return file[:len(file)-9] + "index.html"
 	}
+	// otherwise we just change the extension
+	return file[:len(file)-3] + ".html"
 }
 
 func pathFirstPart(path string) string {
@@ -94,66 +124,222 @@ func pathHasDot(path string) bool {
 	return false
 }
 
+var (
+	// movefiles is true if the non markdown files should be moved to the output folder
+	movefiles bool
+	// outstart is the first part of the output folder path (relative to the current folder)
+	outstart string
+)
+
 // buildFiles convert all .md files verifying one of the patterns to .html
-func buildFiles() {
+// After the first failed file no new file is built, except with --keep-going
+// where all the possible files are built and the failed ones are listed at the end.
+func buildFiles() error {
 	// get the current directory
 	cwd, err := os.Getwd()
-	check(err, "Problem getting the current directory.")
+	if err != nil {
+		return fail(err, "Problem getting the current directory.")
+	}
 	// get the current directory as a filesystem, needed for doublestar.Glob
 	dirFS := os.DirFS(cwd)
+	// the build cache is kept only in an output folder (not to litter the sources)
+	useCache := outdir != ""
 	// normalize the output directory and set movefiles and outstart
 	outdir, err = filepath.Abs(outdir)
-	check(err, "Problem getting the absolute path of the output directory.")
-	movefiles := move && outdir != cwd
+	if err != nil {
+		return fail(err, "Problem getting the absolute path of the output directory.")
+	}
+	movefiles = move && outdir != cwd
 	outdir, err = filepath.Rel(cwd, outdir)
-	check(err, "Problem getting the relative path of the output directory.")
+	if err != nil {
+		return fail(err, "Problem getting the relative path of the output directory.")
+	}
 	// get the first part of the relative out path
-	outstart := pathFirstPart(outdir)
+	outstart = pathFirstPart(outdir)
+	// the site navigation is part of every page
+	if navigation {
+		site, err = findSiteNav(".", inpatterns)
+		if err != nil {
+			return fail(err, "Problem building the site navigation.")
+		}
+	}
+	// use the build cache to skip the unchanged files
+	if useCache {
+		cache = loadCache()
+		if force {
+			clear(cache.Files)
+		}
+	}
+	// collect the built pages for the sitemap
+	if sitemapURL != "" {
+		sitemap = newSiteMap(sitemapURL)
+	}
 	// check all patterns
 	action := "Building"
-	if movefiles {
+	if movefiles && watch {
+		action = "Building and copying"
+	} else if movefiles {
 		action = "Building and moving"
 	}
 	info(action+" files from '%s' to '%s'.\n", cwd, outdir)
+
+	// the files are sent to `jobs` concurrent workers
+	files := make(chan string)
+	var (
+		mu        sync.Mutex
+		failed    = make(map[string]error)
+		firstFail error
+		total     int
+	)
+	// done records the result of the (processed) file:
+	// with --keep-going the errors are listed at the end,
+	// otherwise the first error is returned (and the ones of the files already in progress are printed)
+	done := func(infile string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		total++
+		if err == nil {
+			return
+		}
+		failed[infile] = err
+		switch {
+		case keepGoing:
+		case firstFail == nil:
+			firstFail = fail(err, "Problem building", infile)
+		default:
+			try(err, "Problem building", infile)
+		}
+	}
+	// stopped is true after the first error (without --keep-going)
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !keepGoing && len(failed) > 0
+	}
+	var wg sync.WaitGroup
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for infile := range files {
+				if stopped() {
+					continue
+				}
+				done(infile, buildFile(infile))
+			}
+		}()
+	}
+	var globErr error
 	for _, pattern := range inpatterns {
+		if stopped() {
+			break
+		}
 		info("Looking for '%s'.\n", pattern)
 		// if the input is piped
 		if pattern == "stdin" {
-			buildMd("")
+			done("stdin", buildMd("", nil))
 			continue
 		}
 		// look for all files with the given patterns
 		// but build only .md ones
 		allfiles, err := doublestar.Glob(dirFS, pattern, doublestar.WithFilesOnly(), doublestar.WithNoFollow())
-		check(err, "Problem looking for file pattern:", pattern)
+		if err != nil {
+			globErr = usage(fail(err, "Problem looking for file pattern:", pattern))
+			break
+		}
 		if len(allfiles) == 0 {
 			info("No files found.\n")
 			continue
 		}
 		for _, infile := range allfiles {
-			infile = filepath.Clean(infile)
-			if skipdot && pathHasDot(infile) {
-				info("  Skipping %s...\n", infile)
-				continue
-			}
-			if strings.HasPrefix(infile, outstart) {
-				continue
+			files <- filepath.Clean(infile)
+		}
+	}
+	close(files)
+	wg.Wait()
+
+	try(cache.save(), "Problem saving the build cache.")
+	if globErr != nil {
+		return globErr
+	}
+	if len(failed) == 0 || keepGoing {
+		if err := sitemap.save(); err != nil {
+			return fail(err, "Problem saving the sitemap.")
+		}
+	}
+	if firstFail != nil {
+		return firstFail
+	}
+	if len(failed) > 0 {
+		return fail(&partialError{failed: failed, total: total}, "Build failed.")
+	}
+	return nil
+}
+
+// buildFile converts the infile if it is a .md file,
+// or moves it to the output folder if necessary (copies it when watching).
+// A single info line is printed for every built file.
+func buildFile(infile string) error {
+	if strings.HasPrefix(infile, outstart) {
+		return nil
+	}
+	if skipdot && pathHasDot(infile) {
+		info("  Skipping %s...\n", infile)
+		return nil
+	}
+	if strings.HasSuffix(infile, ".md") {
+		hash, ok := cache.upToDate(infile)
+		if ok {
+			info("  Skipping unchanged %s...\n", infile)
+			sitemap.add(infile)
+			return nil
+		}
+		deps := newFileDeps()
+		if err := buildMd(infile, deps); err != nil {
+			return err
+		}
+		cache.set(infile, hash, deps)
+		sitemap.add(infile)
+		info("  Converting %s...done.\n", infile)
+	} else if movefiles {
+		// move the file if it is not markdown and not already in the output folder
+		outfile := filepath.Join(outdir, infile)
+		if err := os.MkdirAll(filepath.Dir(outfile), os.ModePerm); err != nil {
+			return fmt.Errorf("problem to reach/create folder %s: %w", filepath.Dir(outfile), err)
+		}
+		if watch {
+			// when watching the source files should stay in place
+			if err := copyFile(infile, outfile); err != nil {
+				return fmt.Errorf("problem copying %s: %w", infile, err)
 			}
-			if strings.HasSuffix(infile, ".md") {
-				info("  Converting %s...", infile)
-				buildMd(infile)
-				info("done.\n")
-			} else if movefiles {
-				// move the file if it is not markdown and not already in the output folder
-				info("  Moving %s...", infile)
-				outfile := filepath.Join(outdir, infile)
-				if os.MkdirAll(filepath.Dir(outfile), os.ModePerm) != nil {
-					check(err, "Problem to reach/create folder:", filepath.Dir(outfile))
-				}
-				err := os.Rename(infile, outfile)
-				check(err, "Problem moving", infile)
-				info("done.\n")
+			info("  Copying %s...done.\n", infile)
+		} else {
+			if err := os.Rename(infile, outfile); err != nil {
+				return fmt.Errorf("problem moving %s: %w", infile, err)
 			}
+			info("  Moving %s...done.\n", infile)
 		}
 	}
+	return nil
+}
+
+// copyFile copies the content of infile to outfile.
+func copyFile(infile, outfile string) error {
+	in, err := os.Open(infile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(outfile)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// builtSite is the output tree of the served folder, built in memory (with `gm serve --built`).
+// The pages are keyed by their url path, and the build errors are kept to be shown in the browser.
+type builtSite struct {
+	pages  map[string][]byte
+	errors map[string]error
+	files  map[string]string // the .md file of each page
+
+	mu sync.RWMutex
+}
+
+// built is the in-memory build of the served folder
+var built = &builtSite{}
+
+// build compiles all the .md files of the served folder, as the build would do.
+func (b *builtSite) build() {
+	pages := make(map[string][]byte)
+	errors := make(map[string]error)
+	files := make(map[string]string)
+	nav := servedSite()
+	err := filepath.WalkDir(serveDir, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipdot && filename != serveDir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(filename, ".md") {
+			return nil
+		}
+		file, err := filepath.Rel(serveDir, filename)
+		if err != nil {
+			return err
+		}
+		urlPath := "/" + filepath.ToSlash(htmlName(file))
+		files[urlPath] = filename
+		markdown, err := os.ReadFile(filename)
+		if err == nil {
+			pages[urlPath], err = buildPage(markdown, filepath.Dir(filename), nav.page(file), nil)
+		}
+		if err != nil {
+			errors[urlPath] = err
+		}
+		return nil
+	})
+	try(err, "Problem building the served folder.")
+	b.mu.Lock()
+	b.pages, b.errors, b.files = pages, errors, files
+	b.mu.Unlock()
+	info("\nBuilt %d page(s) in memory.", len(pages))
+}
+
+// injectReload inserts the reload script at the end of the html body.
+func injectReload(html []byte) []byte {
+	script := []byte(`<script src="/__gm/reload.js"></script>` + "\n")
+	i := bytes.LastIndex(html, []byte("</body>"))
+	if i < 0 {
+		return append(html, script...)
+	}
+	return append(html[:i:i], append(script, html[i:]...)...)
+}
+
+// ServeHTTP serves the built pages, and the other (non .md) files from the disk.
+func (b *builtSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlPath := r.URL.Path
+	if strings.HasSuffix(urlPath, "/") {
+		urlPath += "index.html"
+	}
+	b.mu.RLock()
+	html, ok := b.pages[urlPath]
+	err := b.errors[urlPath]
+	filename := b.files[urlPath]
+	b.mu.RUnlock()
+	switch {
+	case err != nil:
+		file, _ := filepath.Rel(serveDir, filename)
+		serveError(w, file, err)
+	case ok:
+		events.setResources(filename, html)
+		info(" serve built page.")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(injectReload(html))
+	case path.Ext(urlPath) == ".md":
+		// the sources are not part of the output
+		http.NotFound(w, r)
+	default:
+		info(" serve raw file.")
+		w.Header().Set("Cache-Control", "no-store")
+		http.FileServer(http.Dir(serveDir)).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+// cacheName is the name of the build cache file in the output folder
+const cacheName = ".gm-cache"
+
+// buildCache keeps the content hash of the already built sources.
+// The cache is valid only for the same configuration fingerprint.
+// The cache can be used by concurrent builds.
+type buildCache struct {
+	Fingerprint string                `json:"fingerprint"`
+	Files       map[string]cacheEntry `json:"files"`
+
+	mu sync.Mutex
+}
+
+// cacheEntry is the content hash of a built source,
+// with the other local files used by its build.
+type cacheEntry struct {
+	Hash string    `json:"hash"`
+	Deps *fileDeps `json:"deps,omitempty"`
+}
+
+// fileDeps are the local files used to build a page, except its source:
+// the front matter template and the files inlined with --self-contained, with their content hash,
+// and the targets of the .md links, with their existence (that decides if the link is rewritten).
+type fileDeps struct {
+	Files map[string]string `json:"files,omitempty"`
+	Links map[string]bool   `json:"links,omitempty"`
+}
+
+// newFileDeps returns empty dependencies.
+func newFileDeps() *fileDeps {
+	return &fileDeps{Files: make(map[string]string), Links: make(map[string]bool)}
+}
+
+// add records the current content hash of the file (if deps is not nil).
+func (deps *fileDeps) add(name string) {
+	if deps != nil {
+		deps.Files[name] = fileHash(name)
+	}
+}
+
+// addLink records if the target of a .md link exists (if deps is not nil).
+func (deps *fileDeps) addLink(name string, exists bool) {
+	if deps != nil {
+		deps.Links[name] = exists
+	}
+}
+
+// changed reports if one of the files changed since it was recorded.
+func (deps *fileDeps) changed() bool {
+	if deps == nil {
+		return false
+	}
+	for name, hash := range deps.Files {
+		if fileHash(name) != hash {
+			return true
+		}
+	}
+	for name, exists := range deps.Links {
+		if _, err := os.Stat(name); (err == nil) != exists {
+			return true
+		}
+	}
+	return false
+}
+
+// fileHash returns the content hash of the file, or "" if it can't be read.
+func fileHash(name string) string {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// cache is the current build cache (nil if not used)
+var cache *buildCache
+
+// unfingerprinted are the flags that do not change the output of a build
+var unfingerprinted = map[string]bool{
+	"serve":      true,
+	"built":      true,
+	"timeout":    true,
+	"host":       true,
+	"port":       true,
+	"no-open":    true,
+	"browser":    true,
+	"tls":        true,
+	"cert":       true,
+	"key":        true,
+	"watch":      true,
+	"jobs":       true,
+	"force":      true,
+	"keep-going": true,
+	"quiet":      true,
+	"help":       true,
+	"config":     true,
+	"sitemap":    true,
+	"feed-url":   true,
+	"feed-title": true,
+}
+
+// configFingerprint returns a hash of everything (except the sources) that can change the output:
+// the flags values (including the template content), the regex rules and the versions.
+func configFingerprint() string {
+	h := sha256.New()
+	fmt.Fprintln(h, version, goldmarkVersion)
+	pflag.VisitAll(func(f *pflag.Flag) {
+		if !unfingerprinted[f.Name] {
+			fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value.String())
+		}
+	})
+	fmt.Fprintln(h, "nav", site.fingerprint())
+	for _, rule := range reMdRules {
+		fmt.Fprintln(h, "re-md", rule)
+	}
+	for _, rule := range reHtmlRules {
+		fmt.Fprintln(h, "re-html", rule)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCache reads the cache from the output folder.
+// If the cache is missing, broken or for another configuration, an empty cache is returned.
+func loadCache() *buildCache {
+	c := &buildCache{Fingerprint: configFingerprint(), Files: make(map[string]cacheEntry)}
+	content, err := os.ReadFile(filepath.Join(outdir, cacheName))
+	if err != nil {
+		return c
+	}
+	var old buildCache
+	if json.Unmarshal(content, &old) == nil && old.Fingerprint == c.Fingerprint && old.Files != nil {
+		c.Files = old.Files
+	}
+	return c
+}
+
+// save writes the cache to the output folder (if not empty).
+func (c *buildCache) save() error {
+	if c == nil || len(c.Files) == 0 {
+		return nil
+	}
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outdir, cacheName), content, 0644)
+}
+
+// upToDate checks if infile and the other files used by its build have the same content
+// as during the last build, and if its output is still present. It returns the content hash of infile.
+func (c *buildCache) upToDate(infile string) (hash string, ok bool) {
+	if c == nil {
+		return "", false
+	}
+	hash = fileHash(infile)
+	if hash == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	old := c.Files[infile]
+	c.mu.Unlock()
+	if old.Hash != hash || old.Deps.changed() {
+		return hash, false
+	}
+	if _, err := os.Stat(outputName(infile)); err != nil {
+		return hash, false
+	}
+	return hash, true
+}
+
+// set records the content hash of the built infile and the files used by its build.
+func (c *buildCache) set(infile, hash string, deps *fileDeps) {
+	if c != nil && hash != "" {
+		c.mu.Lock()
+		c.Files[infile] = cacheEntry{Hash: hash, Deps: deps}
+		c.mu.Unlock()
+	}
+}
+
+// remove forgets the deleted infile.
+func (c *buildCache) remove(infile string) {
+	if c != nil {
+		c.mu.Lock()
+		delete(c.Files, infile)
+		c.mu.Unlock()
+	}
+}
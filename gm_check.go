@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/yuin/goldmark/ast"
+)
+
+// regexID matches the id (and name) attributes of the html elements
+var regexID = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*"([^"]*)"`)
+
+// regexScheme matches the urls with a scheme like http: or mailto:
+var regexScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// documentIDs caches the ids of the already checked target files
+var documentIDs = make(map[string]map[string]bool)
+
+// checkFiles checks the links of all .md files verifying one of the patterns.
+// With --keep-going the files that can't be checked are skipped, and listed at the end.
+func checkFiles() error {
+	// get the current directory as a filesystem, needed for doublestar.Glob
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fail(err, "Problem getting the current directory.")
+	}
+	dirFS := os.DirFS(cwd)
+
+	checked := make(map[string]bool)
+	failed := make(map[string]error)
+	problems := 0
+	for _, pattern := range inpatterns {
+		info("Looking for '%s'.\n", pattern)
+		allfiles, err := doublestar.Glob(dirFS, pattern, doublestar.WithFilesOnly(), doublestar.WithNoFollow())
+		if err != nil {
+			return usage(fail(err, "Problem looking for file pattern:", pattern))
+		}
+		if len(allfiles) == 0 {
+			info("No files found.\n")
+			continue
+		}
+		for _, infile := range allfiles {
+			infile = filepath.Clean(infile)
+			if !strings.HasSuffix(infile, ".md") || checked[infile] || (skipdot && pathHasDot(infile)) {
+				continue
+			}
+			checked[infile] = true
+			n, err := checkFile(infile)
+			if err != nil && !keepGoing {
+				return fail(err, "Problem checking", infile)
+			}
+			if err != nil {
+				failed[infile] = err
+			}
+			problems += n
+		}
+	}
+
+	info("%d file(s) checked, %d problem(s) found.\n", len(checked), problems)
+	var partial error
+	if len(failed) > 0 {
+		partial = &partialError{failed: failed, total: len(checked)}
+	}
+	if problems > 0 {
+		// the problems found are a failure, even if some files were not checked
+		try(partial)
+		return fail(fmt.Errorf("%d problem(s) found", problems), "Check failed.")
+	}
+	return fail(partial, "Check failed.")
+}
+
+// checkFile prints the broken links, the missing images and the unknown anchors of infile.
+// It returns the number of problems found.
+func checkFile(infile string) (int, error) {
+	markdown, err := os.ReadFile(infile)
+	if err != nil {
+		return 0, err
+	}
+	res, err := convert(markdown)
+	if err != nil {
+		return 0, err
+	}
+
+	dir := filepath.Dir(infile)
+	problems := 0
+	err = ast.Walk(res.Doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var dest, what string
+		switch n := n.(type) {
+		case *ast.Link:
+			dest, what = string(n.Destination), "broken link"
+		case *ast.Image:
+			dest, what = string(n.Destination), "missing image"
+		default:
+			return ast.WalkContinue, nil
+		}
+		if problem := checkLink(dest, dir, infile, what); problem != "" {
+			// the lines of the front matter are counted to report the file lines
+			fmt.Printf("%s:%d: %s\n", filepath.ToSlash(infile), res.Offset+nodeLine(n, res.Source), problem)
+			problems++
+		}
+		return ast.WalkContinue, nil
+	})
+	return problems, err
+}
+
+// checkLink returns the problem with the dest link found in infile (or "" if none).
+// The relative paths are relative to dir, and the absolute ones to the current folder.
+func checkLink(dest, dir, infile, what string) string {
+	if dest == "" || strings.HasPrefix(dest, "//") || regexScheme.MatchString(dest) {
+		return ""
+	}
+	link, fragment, _ := strings.Cut(dest, "#")
+	link, _, _ = strings.Cut(link, "?")
+	name, err := url.PathUnescape(link)
+	if err != nil {
+		return fmt.Sprintf("%s %q", what, dest)
+	}
+
+	target := infile
+	if name != "" {
+		if strings.HasPrefix(name, "/") {
+			target = filepath.Clean(filepath.FromSlash(name[1:]))
+		} else {
+			target = filepath.Join(dir, filepath.FromSlash(name))
+		}
+		if _, err := os.Stat(target); err != nil {
+			// the .html file is built from the .md one
+			md := strings.TrimSuffix(target, ".html") + ".md"
+			if !strings.HasSuffix(target, ".html") {
+				return fmt.Sprintf("%s %q", what, dest)
+			}
+			if _, err := os.Stat(md); err != nil {
+				return fmt.Sprintf("%s %q", what, dest)
+			}
+			target = md
+		}
+	}
+
+	if fragment == "" {
+		return ""
+	}
+	ext := strings.ToLower(filepath.Ext(target))
+	if ext != ".md" && ext != ".html" && ext != ".htm" {
+		return ""
+	}
+	ids, err := targetIDs(target)
+	if err != nil {
+		return fmt.Sprintf("can't read %s to check %q: %s", filepath.ToSlash(target), dest, err)
+	}
+	if fragment, err := url.PathUnescape(fragment); err != nil || !ids[fragment] {
+		return fmt.Sprintf("unknown anchor %q in %s", "#"+fragment, filepath.ToSlash(target))
+	}
+	return ""
+}
+
+// targetIDs returns the ids of the html file (or of the compiled .md file).
+func targetIDs(target string) (map[string]bool, error) {
+	if ids, ok := documentIDs[target]; ok {
+		return ids, nil
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(target), ".md") {
+		if content, err = compile(content, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	ids := make(map[string]bool)
+	for _, m := range regexID.FindAllSubmatch(content, -1) {
+		ids[string(m[1])] = true
+	}
+	documentIDs[target] = ids
+	return ids, nil
+}
+
+// nodeLine returns the line (starting from 1) of the node in source.
+func nodeLine(n ast.Node, source []byte) int {
+	start := -1
+	// the first text of the node or of one of its descendants
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := c.(*ast.Text); ok && entering {
+			start = t.Segment.Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	// otherwise the first line of the parent block
+	for p := n; start < 0 && p != nil; p = p.Parent() {
+		if p.Type() == ast.TypeBlock && p.Lines().Len() > 0 {
+			start = p.Lines().At(0).Start
+		}
+	}
+	if start < 0 {
+		return 1
+	}
+	return bytes.Count(source[:start], []byte("\n")) + 1
+}
@@ -1,83 +1,88 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
-	"github.com/grokify/html-strip-tags-go"
+	"github.com/kpym/gm/render"
 )
 
-// regexTitle is used to find the first h1 title (if any)
-var regexTitle = regexp.MustCompile(`(?m)<h1[^>]*>(.*?)</h1>`)
+// templateMutex protects the converter (and the template error) reloaded when serving
+var templateMutex sync.RWMutex
 
-// getTitle search for the first h1 title in the markdown
-// if there is no one it returns the default title
-func getTitle(htmlStr string) string {
-	res := regexTitle.FindStringSubmatch(htmlStr)
-	if len(res) > 1 {
-		return strip.StripTags(string(res[1]))
-	}
+// converter is the markdown to html converter built from the flags
+var converter *render.Converter
+
+// templateErr is the template parsing error, if any (only when serving)
+var templateErr error
 
-	return "GoldMark"
+// currentConverter returns the converter (that can be reloaded when serving).
+func currentConverter() *render.Converter {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	return converter
 }
 
 // compile convert markdown to full html
-// by first applying markdown
-// and then integrating the result in a html template
-func compile(markdown []byte) (html []byte, err error) {
-	// temporary buffer
-	var htmlBuf bytes.Buffer
-
-	// convert md to html code
-	err = mdParser.Convert(markdown, &htmlBuf)
+// by first extracting the front matter (if any),
+// then applying markdown
+// and then integrating the result in a html template.
+// The site navigation nav is optional.
+// The front matter template file (if any) is recorded in deps (if not nil).
+func compile(markdown []byte, nav *pageNav, deps *fileDeps) (html []byte, err error) {
+	res, err := convert(markdown)
 	if err != nil {
-		return nil, fmt.Errorf("problem parsing markdown code to html with goldmark: %w", err)
-	}
-	htmlStr := htmlBuf.String()
-
-	// combine the template and the resulting html
-	var data = make(map[string]any)
-	// the title as parameter or from the first h1
-	if title != "" {
-		data["title"] = template.HTML(title)
-	} else {
-		data["title"] = template.HTML(getTitle(htmlStr))
+		return nil, err
 	}
-	// the favicon url
-	if favicon != "" {
-		data["favicon"] = template.HTML(favicon)
-	}
-	// the css can be either an url or a code
-	type cssType struct {
-		Url  template.HTML
-		Code template.HTML
-	}
-	cssall := make([]cssType, len(css))
-	for i, c := range css {
-		if strings.HasPrefix(c, "<style>") {
-			cssall[i] = cssType{Code: template.HTML(c)}
-		} else {
-			cssall[i] = cssType{Url: template.HTML(c)}
+	if shell, ok := render.MetaString(res.Meta, "template"); ok {
+		if fi, err := os.Stat(shell); err == nil && fi.Mode().IsRegular() {
+			deps.add(shell)
 		}
 	}
-	data["css"] = cssall
-	data["html"] = template.HTML(htmlStr)
-	if liveupdate {
-		data["liveupdate"] = template.HTML("yes")
+	return renderPage(res, nav)
+}
+
+// convert applies the re-md rules, extracts the front matter (if any) and converts the markdown to html code.
+func convert(markdown []byte) (*render.Result, error) {
+	return currentConverter().Convert(context.Background(), markdown)
+}
+
+// fileTitle returns the title of the converted file (as html, used by the nav and the feed):
+// the front matter `title`, the first h1 or the file name (without .md).
+func fileTitle(res *render.Result, file string) string {
+	if res.DocumentTitle != "" {
+		return res.DocumentTitle
 	}
+	return template.HTMLEscapeString(strings.TrimSuffix(filepath.Base(file), ".md"))
+}
 
-	htmlBuf.Reset()
-	err = mdTemplate.Execute(&htmlBuf, data)
+// renderPage integrates the converted html code in the html template,
+// with the site navigation nav (if any) and the reload script (when serving).
+func renderPage(res *render.Result, nav *pageNav) (html []byte, err error) {
+	// the template can be reloaded when serving
+	templateMutex.RLock()
+	c, err := converter, templateErr
+	templateMutex.RUnlock()
 	if err != nil {
-		return nil, fmt.Errorf("problem building HTML from template: %w", err)
+		return nil, err
 	}
 
-	return htmlBuf.Bytes(), nil
+	data := make(map[string]any)
+	if nav != nil {
+		data["nav"] = nav.Items
+		data["prev"] = nav.Prev
+		data["next"] = nav.Next
+	}
+	if liveupdate {
+		data["liveupdate"] = template.HTML("yes")
+	}
+	return c.Page(res, data)
 }
 
 // regexMdLink is used to identify .md links like href="xxxx.md"
@@ -85,22 +90,25 @@ func compile(markdown []byte) (html []byte, err error) {
 var regexMdLink = regexp.MustCompile(`href\s*=\s*"[^"]+?\.md#?[^"]*?"`)
 
 // replaceLinks replaces all links like href="path/xxxx.md#tag" to href="path/xxxx.html#tag"
-// if the file `path/xxxx.md` exists
-func replaceLinks(html []byte, dir string) []byte {
+// if the file `path/xxxx.md` exists (README.md is replaced by index.html with --readme-index).
+// The checked files are recorded in deps (if not nil).
+func replaceLinks(html []byte, dir string, deps *fileDeps) []byte {
 	// replace .md links with .html for local files
 	return regexMdLink.ReplaceAllFunc(html, func(s []byte) []byte {
 		fullhref := strings.Split(string(s), `"`)[1]
 		filename := strings.Split(string(fullhref), `#`)[0]
 		relname := filepath.Join(dir, filename)
-		if _, err := os.Stat(relname); err != nil {
+		_, err := os.Stat(relname)
+		deps.addLink(relname, err == nil)
+		if err != nil {
 			return s
 		}
 
 		if fullhref == filename {
-			return []byte(fmt.Sprintf(`href="%s.html"`, filename[:len(filename)-3]))
+			return []byte(fmt.Sprintf(`href="%s"`, htmlName(filename)))
 		}
 
 		tagname := strings.Split(fullhref, `#`)[1]
-		return []byte(fmt.Sprintf(`href="%s.html#%s"`, filename[:len(filename)-3], tagname))
+		return []byte(fmt.Sprintf(`href="%s#%s"`, htmlName(filename), tagname))
 	})
 }
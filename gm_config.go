@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are the configuration files looked for in the current folder
+// if no `--config` flag is used.
+var defaultConfigFiles = []string{"gm.yaml", "gm.yml", "gm.toml"}
+
+// findConfigFile returns the configuration file to use (if any).
+func findConfigFile() string {
+	if configFile != "" {
+		return configFile
+	}
+	for _, name := range defaultConfigFiles {
+		if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+			return name
+		}
+	}
+	return ""
+}
+
+// readConfig decodes the configuration file (yaml or toml based on the extension).
+func readConfig(filename string) (map[string]any, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]any)
+	if strings.ToLower(filepath.Ext(filename)) == ".toml" {
+		err = toml.Unmarshal(content, &config)
+	} else {
+		err = yaml.Unmarshal(content, &config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyConfig sets the flags values from the configuration file.
+// The flags already set on the command line are not modified,
+// and the empty values (like `title:` in yaml) keep the default.
+func applyConfig(flags *pflag.FlagSet, filename string) error {
+	config, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+	for key, value := range config {
+		f := flags.Lookup(key)
+		if f == nil || key == "config" || key == "help" {
+			return fmt.Errorf("unknown option '%s'", key)
+		}
+		// the command line wins
+		if f.Changed || value == nil {
+			continue
+		}
+		// we set the value directly to keep f.Changed to false
+		switch v := value.(type) {
+		case []any:
+			if !strings.HasSuffix(f.Value.Type(), "Array") {
+				return fmt.Errorf("option '%s' accepts only one value", key)
+			}
+			for _, item := range v {
+				if item == nil {
+					return fmt.Errorf("empty value in the list of option '%s'", key)
+				}
+				if err := f.Value.Set(fmt.Sprint(item)); err != nil {
+					return fmt.Errorf("invalid value for option '%s': %w", key, err)
+				}
+			}
+		case map[string]any:
+			return fmt.Errorf("invalid value for option '%s'", key)
+		default:
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("invalid value for option '%s': %w", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dumpConfig prints the effective configuration (command line merged with the configuration file) as yaml.
+// The options are printed in the order of the help message.
+func dumpConfig(filename string) error {
+	doc := yaml.Node{Kind: yaml.MappingNode}
+	if filename != "" {
+		doc.HeadComment = "configuration file: " + filename
+	}
+	var err error
+	pflag.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Name == "config" || f.Name == "help" {
+			return
+		}
+		var value any
+		switch f.Value.Type() {
+		case "bool":
+			value, err = pflag.CommandLine.GetBool(f.Name)
+		case "int":
+			value, err = pflag.CommandLine.GetInt(f.Name)
+		case "stringArray":
+			value, err = pflag.CommandLine.GetStringArray(f.Name)
+		default:
+			value = f.Value.String()
+		}
+		var valueNode yaml.Node
+		if err == nil {
+			err = valueNode.Encode(value)
+		}
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.Name}, &valueNode)
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		config string
+		args   []string
+		title  string
+		css    []string
+		math   bool
+		err    bool
+	}{
+		{
+			name:   "defaults",
+			file:   "gm.yaml",
+			config: "",
+			css:    []string{"github"},
+		},
+		{
+			name:   "yaml values",
+			file:   "gm.yaml",
+			config: "title: Hello\ngm-math: true\n",
+			title:  "Hello",
+			css:    []string{"github"},
+			math:   true,
+		},
+		{
+			name:   "toml values",
+			file:   "gm.toml",
+			config: "title = \"Hello\"\ncss = [\"air\"]\n",
+			title:  "Hello",
+			css:    []string{"air"},
+		},
+		{
+			name:   "the list replaces the default",
+			file:   "gm.yaml",
+			config: "css:\n  - air\n  - custom.css\n",
+			css:    []string{"air", "custom.css"},
+		},
+		{
+			name:   "a single value replaces the default list",
+			file:   "gm.yaml",
+			config: "css: dark\n",
+			css:    []string{"dark"},
+		},
+		{
+			name:   "the command line wins",
+			file:   "gm.yaml",
+			config: "title: File\ncss: [air]\ngm-math: true\n",
+			args:   []string{"--title", "Flag", "--css", "dark", "--css", "a.css", "--gm-math=false"},
+			title:  "Flag",
+			css:    []string{"dark", "a.css"},
+		},
+		{
+			name:   "empty values keep the defaults",
+			file:   "gm.yaml",
+			config: "title:\ncss:\n",
+			css:    []string{"github"},
+		},
+		{
+			name:   "empty value in a list",
+			file:   "gm.yaml",
+			config: "css: [air, null]\n",
+			err:    true,
+		},
+		{
+			name:   "unknown option",
+			file:   "gm.yaml",
+			config: "nope: 1\n",
+			err:    true,
+		},
+		{
+			name:   "list for a single value option",
+			file:   "gm.yaml",
+			config: "title: [a, b]\n",
+			err:    true,
+		},
+		{
+			name:   "map value",
+			file:   "gm.yaml",
+			config: "title:\n  a: b\n",
+			err:    true,
+		},
+		{
+			name:   "invalid bool",
+			file:   "gm.yaml",
+			config: "gm-math: maybe\n",
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("gm", pflag.ContinueOnError)
+			flags.String("title", "", "")
+			flags.StringArray("css", []string{"github"}, "")
+			flags.Bool("gm-math", false, "")
+			if err := flags.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(filename, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyConfig(flags, filename)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if title, _ := flags.GetString("title"); title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if css, _ := flags.GetStringArray("css"); !reflect.DeepEqual(css, tt.css) {
+				t.Errorf("css = %q, want %q", css, tt.css)
+			}
+			if math, _ := flags.GetBool("gm-math"); math != tt.math {
+				t.Errorf("gm-math = %v, want %v", math, tt.math)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kpym/gm/render"
+)
+
+// regexTemplateLine matches the position in the template errors like `template: md:12: ...` or `html/template:md:12:3: ...`
+var regexTemplateLine = regexp.MustCompile(`template: ?[^:]*:(\d+)`)
+
+// errorTemplate is the page shown in the browser when a served page can't be built.
+// It is independent of the user template (that can be the problem) and keeps the live reload.
+var errorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
+    <title>Error: {{ .file }}</title>
+    <style>
+        body { font-family: sans-serif; margin: 0; background: #fff5f5; color: #24292f; }
+        .markdown-body { max-width: 980px; margin: 0 auto; padding: 45px; }
+        h1 { color: #cf222e; font-size: 1.5em; }
+        li { margin: 0.5em 0; font-family: monospace; white-space: pre-wrap; }
+        pre { background: #fff; border: 1px solid #ffcecb; padding: 1em; overflow: auto; }
+        .error-line { background: #ffcecb; display: block; }
+    </style>
+</head>
+
+<body>
+    <article class="markdown-body">
+        <h1>Problem building {{ .file }}</h1>
+        <ul>
+            {{- range .messages }}
+            <li>{{ . }}</li>
+            {{- end }}
+        </ul>
+        {{- with .lines }}
+        <p>Template line {{ $.line }}:</p>
+        <pre>{{ range . }}<span{{ if .Error }} class="error-line"{{ end }}>{{ .Number }}: {{ .Text }}</span>
+{{ end }}</pre>
+        {{- end }}
+        <p>The page is reloaded when the problem is fixed.</p>
+    </article>
+    <script src="/__gm/reload.js"></script>
+</body>
+
+</html>`))
+
+// errorMessages returns the messages of the error chain, from the outer to the inner one.
+// The inner messages are removed from the outer ones.
+func errorMessages(err error) []string {
+	var messages []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		message := err.Error()
+		if inner := errors.Unwrap(err); inner != nil {
+			message = strings.TrimSuffix(strings.TrimSuffix(message, inner.Error()), ": ")
+		}
+		if message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// templateLines returns the template lines around the line of the template error (if any).
+func templateLines(err error) (line int, lines []map[string]any) {
+	var terr *render.TemplateError
+	if !errors.As(err, &terr) {
+		return 0, nil
+	}
+	m := regexTemplateLine.FindStringSubmatch(terr.Error())
+	if m == nil {
+		return 0, nil
+	}
+	line, _ = strconv.Atoi(m[1])
+	source := strings.Split(terr.Source, "\n")
+	for i := max(line-3, 1); i <= min(line+3, len(source)); i++ {
+		lines = append(lines, map[string]any{
+			"Number": i,
+			"Text":   strings.TrimRight(source[i-1], "\r"),
+			"Error":  i == line,
+		})
+	}
+	return line, lines
+}
+
+// serveError sends the error page for the file that can't be built.
+func serveError(w http.ResponseWriter, file string, err error) {
+	info(" error: %s", err)
+	data := map[string]any{
+		"file":     filepath.ToSlash(file),
+		"messages": errorMessages(err),
+	}
+	data["line"], data["lines"] = templateLines(err)
+	var buf bytes.Buffer
+	if err := errorTemplate.Execute(&buf, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// serverEvent is a Server-Sent Event.
+type serverEvent struct {
+	name string
+	data string
+}
+
+// eventClient is a served page listening for events.
+type eventClient struct {
+	page   string // the absolute path of the .md file
+	events chan serverEvent
+}
+
+// eventBroker sends the events to the open pages:
+//   - `reload` when its .md file (or folder), one of its local resources or the template changes;
+//   - `scroll` when an editor asks to show a source line.
+//
+// The editors can listen for the `cursor` events sent by the pages.
+type eventBroker struct {
+	clients   map[*eventClient]bool
+	editors   map[chan serverEvent]bool
+	resources map[string]map[string]bool // the local files used by each served .md file
+	lastSeen  time.Time                  // the last time a page was open
+
+	mu sync.Mutex
+}
+
+// events is the broker used when serving
+var events = &eventBroker{
+	clients:   make(map[*eventClient]bool),
+	editors:   make(map[chan serverEvent]bool),
+	resources: make(map[string]map[string]bool),
+	lastSeen:  time.Now(),
+}
+
+// servedFile returns the absolute path of the .md file (or the folder) served for the url path.
+func servedFile(urlPath string) string {
+	filename := filepath.Join(serveDir, filepath.FromSlash(urlPath))
+	if file, ok := sourceFile(urlPath); ok {
+		filename = file
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// setResources records the local files (stylesheets, images, ...) used by the html of the .md filename.
+func (b *eventBroker) setResources(filename string, html []byte) {
+	page, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(page)
+	resources := make(map[string]bool)
+	for _, m := range regexSrcHref.FindAllSubmatch(html, -1) {
+		src := string(m[1])
+		if src == "" || strings.HasPrefix(src, "//") || regexScheme.MatchString(src) {
+			continue
+		}
+		src, _, _ = strings.Cut(src, "#")
+		src, _, _ = strings.Cut(src, "?")
+		name, err := url.PathUnescape(src)
+		if err != nil || name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, "/") {
+			name = servedFile(name)
+		} else {
+			name = filepath.Join(dir, filepath.FromSlash(name))
+		}
+		resources[name] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.resources[page] = resources
+}
+
+// send sends the event to ch, the event is dropped if too many are pending.
+func send(ch chan serverEvent, e serverEvent) {
+	select {
+	case ch <- e:
+	default:
+	}
+}
+
+// notify sends a reload event to the pages using the changed file.
+// If all is true every page is reloaded.
+func (b *eventBroker) notify(file string, all bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.clients {
+		// the folder listings are reloaded when one of their entries changes
+		if all || c.page == file || c.page == filepath.Dir(file) || b.resources[c.page][file] {
+			send(c.events, serverEvent{"reload", filepath.ToSlash(file)})
+		}
+	}
+}
+
+// scroll sends a scroll event to the pages of the .md file (all pages if file is empty).
+// It returns the number of notified pages.
+func (b *eventBroker) scroll(file string, line int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for c := range b.clients {
+		if file == "" || c.page == file {
+			send(c.events, serverEvent{"scroll", strconv.Itoa(line)})
+			n++
+		}
+	}
+	return n
+}
+
+// cursor sends a cursor event (the source position clicked in a page) to the editors.
+func (b *eventBroker) cursor(file string, line int) {
+	data, _ := json.Marshal(map[string]any{"file": file, "line": line})
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.editors {
+		send(ch, serverEvent{"cursor", string(data)})
+	}
+}
+
+// idle returns for how long no page is open.
+func (b *eventBroker) idle() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.clients) > 0 {
+		return 0
+	}
+	return time.Since(b.lastSeen)
+}
+
+// ServeHTTP streams the reload events of the page given by the `page` url parameter.
+func (b *eventBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	c := &eventClient{page: servedFile(r.URL.Query().Get("page")), events: make(chan serverEvent, 8)}
+	b.mu.Lock()
+	b.clients[c] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.lastSeen = time.Now()
+		b.mu.Unlock()
+	}()
+	streamEvents(w, r, flusher, c.events)
+}
+
+// streamEvents writes the events of ch to w until the request is closed.
+func streamEvents(w http.ResponseWriter, r *http.Request, flusher http.Flusher, ch chan serverEvent) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, e.data)
+			flusher.Flush()
+		}
+	}
+}
+
+// serveScroll handles `POST /__gm/scroll` with the `line` (and optional `file`) values:
+// the open pages of the file scroll to the block of the source line.
+func (b *eventBroker) serveScroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	line, err := strconv.Atoi(r.FormValue("line"))
+	if err != nil || line < 1 {
+		http.Error(w, "the line should be a positive integer", http.StatusBadRequest)
+		return
+	}
+	file := r.FormValue("file")
+	if file != "" {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(serveDir, file)
+		}
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+	}
+	fmt.Fprintf(w, "%d page(s) scrolled\n", b.scroll(file, line))
+}
+
+// serveCursor handles `/__gm/cursor`:
+// the pages POST the clicked source position (`page` and `line`),
+// and the editors GET the stream of these positions as `cursor` events.
+func (b *eventBroker) serveCursor(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		line, err := strconv.Atoi(r.FormValue("line"))
+		if err != nil || line < 1 {
+			http.Error(w, "the line should be a positive integer", http.StatusBadRequest)
+			return
+		}
+		file := servedFile(r.FormValue("page"))
+		if root, err := filepath.Abs(serveDir); err == nil {
+			if rel, err := filepath.Rel(root, file); err == nil {
+				file = filepath.ToSlash(rel)
+			}
+		}
+		b.cursor(file, line)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan serverEvent, 8)
+	b.mu.Lock()
+	b.editors[ch] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.editors, ch)
+		b.mu.Unlock()
+	}()
+	streamEvents(w, r, flusher, ch)
+}
+
+// addServeWatchDirs adds root and all its sub-folders (except the dot ones) to the watcher.
+func addServeWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// watchServed watches the served folder (and the template file) and notifies the open pages of the changes.
+func watchServed() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fail(err, "Problem starting the file watcher.")
+	}
+	defer watcher.Close()
+	root, err := filepath.Abs(serveDir)
+	if err != nil {
+		return fail(err, "Problem getting the absolute path of", serveDir)
+	}
+	if err := addServeWatchDirs(watcher, root); err != nil {
+		return fail(err, "Problem watching the served folder.")
+	}
+	// the template file can be outside the served folder
+	shell := ""
+	if templateFile != "" {
+		shell, _ = filepath.Abs(templateFile)
+		try(watcher.Add(filepath.Dir(shell)), "Problem watching the template", templateFile)
+	}
+
+	// the changed files waiting for the end of the watchDelay
+	pending := make(map[string]bool)
+	var changed <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					try(addServeWatchDirs(watcher, event.Name), "Problem watching the folder", event.Name)
+					continue
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			pending[filepath.Clean(event.Name)] = true
+			changed = time.After(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			try(err, "Problem watching the files.")
+		case <-changed:
+			if pending[shell] {
+				reloadTemplate()
+			}
+			for file := range pending {
+				if strings.HasSuffix(file, ".md") {
+					updateServedNav()
+					break
+				}
+			}
+			if servebuilt {
+				built.build()
+			}
+			for file := range pending {
+				// with the site navigation every .md file is part of all pages
+				events.notify(file, file == shell || (navigation && strings.HasSuffix(file, ".md")))
+			}
+			clear(pending)
+			changed = nil
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/grokify/html-strip-tags-go"
+	"github.com/kpym/gm/render"
+)
+
+// the feed files written in the output folder
+const (
+	atomName = "atom.xml"
+	rssName  = "rss.xml"
+)
+
+// regexParagraph is used to find the first paragraph (the default summary)
+var regexParagraph = regexp.MustCompile(`(?s)<p>(.*?)</p>`)
+
+// feedPost is a feed entry built from a .md file.
+type feedPost struct {
+	title     string
+	link      string
+	author    string
+	summary   string
+	html      string
+	published time.Time
+	updated   time.Time
+}
+
+// readPost compiles the .md infile (without template) and extracts the feed entry data.
+// The dates are the front matter `date` and `lastmod` values, or the file modification time.
+func readPost(infile, baseURL string) (*feedPost, error) {
+	markdown, err := os.ReadFile(infile)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(infile)
+	if err != nil {
+		return nil, err
+	}
+	res, err := convert(markdown)
+	if err != nil {
+		return nil, err
+	}
+	meta := res.Meta
+	content := []byte(res.HTML)
+	if localmdlinks {
+		content = replaceLinks(content, filepath.Dir(infile), nil)
+	}
+
+	post := &feedPost{html: string(content), published: fi.ModTime()}
+	if post.link, err = pageURL(baseURL, outputName(infile)); err != nil {
+		return nil, err
+	}
+	post.title = html.UnescapeString(fileTitle(res, infile))
+	post.author, _ = render.MetaString(meta, "author")
+	if s, ok := render.MetaString(meta, "summary"); ok {
+		post.summary = s
+	} else if s, ok := render.MetaString(meta, "description"); ok {
+		post.summary = s
+	} else if m := regexParagraph.FindStringSubmatch(post.html); m != nil {
+		post.summary = html.UnescapeString(strings.TrimSpace(strip.StripTags(m[1])))
+	}
+	if t, ok := render.MetaDate(meta, "date"); ok {
+		post.published = t
+	}
+	post.updated = post.published
+	if t, ok := render.MetaDate(meta, "lastmod"); ok {
+		post.updated = t
+	}
+	return post, nil
+}
+
+// atomFeed is an Atom feed (see RFC 4287).
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Summary   string      `xml:"summary,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Base string `xml:"xml:base,attr"`
+	Body string `xml:",chardata"`
+}
+
+// rssFeed is a RSS 2.0 feed (see https://www.rssboard.org/rss-specification).
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// writeXML writes v as indented xml in the output folder.
+func writeXML(name string, v any) error {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append([]byte(xml.Header), append(content, '\n')...)
+	if err := os.WriteFile(filepath.Join(outdir, name), content, 0644); err != nil {
+		return fmt.Errorf("problem writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// feedFiles writes the Atom and RSS feeds of all .md files verifying one of the patterns.
+// The newest posts come first.
+// With --keep-going the posts that can't be read are skipped, and listed at the end.
+func feedFiles() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fail(err, "Problem getting the current directory.")
+	}
+	dirFS := os.DirFS(cwd)
+	baseURL := strings.TrimSuffix(feedURL, "/") + "/"
+	if feedTitle == "" {
+		feedTitle = filepath.Base(cwd)
+	}
+
+	var posts []*feedPost
+	seen := make(map[string]bool)
+	failed := make(map[string]error)
+	for _, pattern := range inpatterns {
+		info("Looking for '%s'.\n", pattern)
+		allfiles, err := doublestar.Glob(dirFS, pattern, doublestar.WithFilesOnly(), doublestar.WithNoFollow())
+		if err != nil {
+			return usage(fail(err, "Problem looking for file pattern:", pattern))
+		}
+		for _, infile := range allfiles {
+			infile = filepath.Clean(infile)
+			if !strings.HasSuffix(infile, ".md") || seen[infile] || (skipdot && pathHasDot(infile)) {
+				continue
+			}
+			seen[infile] = true
+			post, err := readPost(infile, baseURL)
+			if err != nil && !keepGoing {
+				return fail(err, "Problem reading", infile)
+			}
+			if err != nil {
+				failed[infile] = err
+				continue
+			}
+			posts = append(posts, post)
+			info("  Adding %s.\n", infile)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].published.After(posts[j].published) })
+
+	var updated time.Time
+	for _, post := range posts {
+		if post.updated.After(updated) {
+			updated = post.updated
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	atom := atomFeed{
+		Title:   feedTitle,
+		ID:      baseURL,
+		Links:   []atomLink{{Href: baseURL}, {Href: baseURL + atomName, Rel: "self"}},
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: feedTitle},
+	}
+	rss := rssFeed{Version: "2.0", Channel: rssChannel{
+		Title:         feedTitle,
+		Link:          baseURL,
+		Description:   feedTitle,
+		LastBuildDate: updated.Format(time.RFC1123Z),
+	}}
+	for _, post := range posts {
+		entry := atomEntry{
+			Title:     post.title,
+			ID:        post.link,
+			Link:      atomLink{Href: post.link},
+			Published: post.published.UTC().Format(time.RFC3339),
+			Updated:   post.updated.UTC().Format(time.RFC3339),
+			Summary:   post.summary,
+			Content:   atomContent{Type: "html", Base: post.link, Body: post.html},
+		}
+		if post.author != "" {
+			entry.Author = &atomAuthor{Name: post.author}
+		}
+		atom.Entries = append(atom.Entries, entry)
+		rss.Channel.Items = append(rss.Channel.Items, rssItem{
+			Title:       post.title,
+			Link:        post.link,
+			GUID:        rssGUID{IsPermaLink: true, Value: post.link},
+			PubDate:     post.published.Format(time.RFC1123Z),
+			Description: post.html,
+		})
+	}
+
+	if err := writeXML(atomName, atom); err != nil {
+		return fail(err, "Problem writing the Atom feed.")
+	}
+	if err := writeXML(rssName, rss); err != nil {
+		return fail(err, "Problem writing the RSS feed.")
+	}
+	info("%d post(s) written to '%s' and '%s'.\n", len(posts), filepath.Join(outdir, atomName), filepath.Join(outdir, rssName))
+	if len(failed) > 0 {
+		return fail(&partialError{failed: failed, total: len(seen)}, "Some posts were not added.")
+	}
+	return nil
+}
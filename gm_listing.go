@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kpym/gm/render"
+)
+
+// indexPage returns the README.md (or index.md) file of the folder dir, if any.
+func indexPage(dir string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, name := range []string{"readme.md", "index.md"} {
+		for _, e := range entries {
+			if !e.IsDir() && strings.ToLower(e.Name()) == name {
+				return filepath.Join(dir, e.Name()), true
+			}
+		}
+	}
+	return "", false
+}
+
+// listingHTML returns the html list of the folder dir (requested as urlPath):
+// the sub-folders, the .md files (with their titles) and the other files.
+func listingHTML(dir, urlPath string, heading string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var folders, pages, files []string
+	for _, e := range entries {
+		name := e.Name()
+		if skipdot && strings.HasPrefix(name, ".") {
+			continue
+		}
+		// the folders (and the links to folders) end with a slash
+		isDir := e.IsDir()
+		if e.Type()&os.ModeSymlink != 0 {
+			if fi, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				isDir = fi.IsDir()
+			}
+		}
+		link := `<a href="` + template.HTMLEscapeString(url.PathEscape(name))
+		switch {
+		case isDir:
+			folders = append(folders, `<li class="folder">`+link+`/">`+template.HTMLEscapeString(name)+`/</a></li>`)
+		case strings.HasSuffix(name, ".md"):
+			title := template.HTML(template.HTMLEscapeString(name))
+			if node, err := readNavNode(dir, name); err == nil {
+				title = node.title
+			}
+			pages = append(pages, fmt.Sprintf(`<li class="page">%s">%s</a> <small>%s</small></li>`, link, title, template.HTMLEscapeString(name)))
+		default:
+			files = append(files, `<li class="file">`+link+`">`+template.HTMLEscapeString(name)+`</a></li>`)
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<nav class="dir-listing">` + "\n")
+	fmt.Fprintf(&b, "<%s>Index of %s</%s>\n<ul>\n", heading, template.HTMLEscapeString(urlPath), heading)
+	if urlPath != "/" {
+		b.WriteString(`<li class="folder"><a href="../">../</a></li>` + "\n")
+	}
+	for _, list := range [][]string{folders, pages, files} {
+		for _, item := range list {
+			b.WriteString(item + "\n")
+		}
+	}
+	b.WriteString("</ul>\n</nav>\n")
+	return b.String(), nil
+}
+
+// listingPage returns the full html page of the folder dir (requested as urlPath):
+// the README.md (or index.md) rendered inline, followed by the folder listing.
+func listingPage(dir, urlPath string) ([]byte, error) {
+	res := &render.Result{}
+	heading := "h1"
+	var nav *pageNav
+	if readme, ok := indexPage(dir); ok {
+		markdown, err := os.ReadFile(readme)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = convert(markdown); err != nil {
+			return nil, err
+		}
+		heading = "h2"
+		nav = serveSiteNav(readme)
+	}
+	listing, err := listingHTML(dir, urlPath, heading)
+	if err != nil {
+		return nil, err
+	}
+	res.HTML += listing
+	html, err := renderPage(res, nav)
+	if err != nil {
+		return nil, err
+	}
+	if len(reHtmlRules) > 0 {
+		html = reHtmlRules.Apply(html)
+	}
+	return html, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/kpym/gm/render"
+)
+
+// navItem is an entry of the site navigation tree (passed to the template as .nav, .prev and .next).
+// The url is relative to the current page, and is empty for the folders without index page.
+type navItem struct {
+	Title  template.HTML
+	URL    string
+	Active bool
+	Open   bool
+	Items  []*navItem
+}
+
+// pageNav is the site navigation seen from a page.
+type pageNav struct {
+	Items []*navItem
+	Prev  *navItem
+	Next  *navItem
+}
+
+// navNode is a page or a folder of the site tree.
+type navNode struct {
+	name   string
+	file   string // the source .md file (empty for the folders without index page)
+	title  template.HTML
+	weight int
+	nodes  []*navNode
+}
+
+// siteNav is the site tree built from the .md files.
+type siteNav struct {
+	root  *navNode
+	pages []*navNode // in the navigation order
+}
+
+// site is the site navigation used by the build (nil if not used)
+var site *siteNav
+
+// servedNav is the site navigation of the served folder (nil if not used),
+// loaded when the serving starts and updated by watchServed when some .md file changes
+var servedNav struct {
+	site *siteNav
+	mu   sync.RWMutex
+}
+
+// isIndexPage checks if the file is the index page of its folder.
+func isIndexPage(file string) bool {
+	base := strings.ToLower(path.Base(file))
+	return base == "readme.md" || base == "index.md"
+}
+
+// readNavNode reads the title and the weight of the .md file.
+// The title is the front matter `title`, the first h1 or the file name.
+func readNavNode(root, file string) (*navNode, error) {
+	markdown, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, err
+	}
+	res, err := convert(markdown)
+	if err != nil {
+		return nil, fmt.Errorf("problem converting %s: %w", file, err)
+	}
+	node := &navNode{name: path.Base(file), file: file, title: template.HTML(fileTitle(res, file))}
+	if w, ok := render.MetaString(res.Meta, "weight"); ok {
+		if node.weight, err = strconv.Atoi(w); err != nil {
+			return nil, fmt.Errorf("the weight of %s should be an integer: %w", file, err)
+		}
+	}
+	return node, nil
+}
+
+// loadSiteNav builds the site tree from the .md files (slash separated paths relative to root).
+// In every folder the pages and the sub-folders are sorted by weight and then by name.
+// A README.md (or index.md) page is the page of its folder.
+// With --keep-going (and when serving) the files that can't be read are skipped.
+func loadSiteNav(root string, files []string) (*siteNav, error) {
+	s := &siteNav{root: &navNode{}}
+	folders := map[string]*navNode{".": s.root}
+	var folder func(dir string) *navNode
+	folder = func(dir string) *navNode {
+		if f, ok := folders[dir]; ok {
+			return f
+		}
+		f := &navNode{name: path.Base(dir), title: template.HTML(template.HTMLEscapeString(path.Base(dir)))}
+		folders[dir] = f
+		parent := folder(path.Dir(dir))
+		parent.nodes = append(parent.nodes, f)
+		return f
+	}
+	for _, file := range files {
+		node, err := readNavNode(root, file)
+		if err != nil && (keepGoing || serve) {
+			try(err, "Problem reading the site navigation, skipping", file)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f := folder(path.Dir(file))
+		if isIndexPage(file) && f.file == "" {
+			f.file, f.title, f.weight = node.file, node.title, node.weight
+		} else {
+			f.nodes = append(f.nodes, node)
+		}
+	}
+	var order func(n *navNode)
+	order = func(n *navNode) {
+		if n.file != "" {
+			s.pages = append(s.pages, n)
+		}
+		sort.SliceStable(n.nodes, func(i, j int) bool {
+			if n.nodes[i].weight != n.nodes[j].weight {
+				return n.nodes[i].weight < n.nodes[j].weight
+			}
+			return n.nodes[i].name < n.nodes[j].name
+		})
+		for _, c := range n.nodes {
+			order(c)
+		}
+	}
+	order(s.root)
+	return s, nil
+}
+
+// findSiteNav builds the site tree from the .md files under root matching one of the patterns.
+// The files in the output folder and (if skipdot) the dot files are ignored.
+func findSiteNav(root string, patterns []string) (*siteNav, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		if pattern == "stdin" {
+			continue
+		}
+		matches, err := doublestar.Glob(os.DirFS(root), pattern, doublestar.WithFilesOnly(), doublestar.WithNoFollow())
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matches {
+			file = path.Clean(file)
+			if !strings.HasSuffix(file, ".md") || seen[file] || (skipdot && pathHasDot(filepath.FromSlash(file))) ||
+				(!serve && strings.HasPrefix(filepath.FromSlash(file), outstart)) {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return loadSiteNav(root, files)
+}
+
+// fingerprint returns a hash of the site tree, that changes if any title, url or order changes.
+func (s *siteNav) fingerprint() string {
+	if s == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, p := range s.pages {
+		fmt.Fprintln(h, p.file, p.title)
+	}
+	var walk func(n *navNode, depth int)
+	walk = func(n *navNode, depth int) {
+		fmt.Fprintln(h, depth, n.name, n.file)
+		for _, c := range n.nodes {
+			walk(c, depth+1)
+		}
+	}
+	walk(s.root, 0)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// navURL returns the url of the page file relative to the folder dir.
+func navURL(dir, file string) string {
+	if file == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(htmlName(file)))
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// page returns the site navigation seen from the page file (nil if not in the site).
+func (s *siteNav) page(file string) *pageNav {
+	if s == nil {
+		return nil
+	}
+	file = filepath.ToSlash(filepath.Clean(file))
+	dir := path.Dir(file)
+	var items func(n *navNode) ([]*navItem, bool)
+	items = func(n *navNode) ([]*navItem, bool) {
+		list := make([]*navItem, 0, len(n.nodes))
+		open := false
+		for _, c := range n.nodes {
+			item := &navItem{Title: c.title, URL: navURL(dir, c.file), Active: c.file == file}
+			item.Items, item.Open = items(c)
+			open = open || item.Active || item.Open
+			list = append(list, item)
+		}
+		return list, open
+	}
+	nav := &pageNav{}
+	nav.Items, _ = items(s.root)
+	if s.root.file != "" {
+		nav.Items = append([]*navItem{{Title: s.root.title, URL: navURL(dir, s.root.file), Active: s.root.file == file}}, nav.Items...)
+	}
+	found := false
+	for i, p := range s.pages {
+		if p.file != file {
+			continue
+		}
+		found = true
+		if i > 0 {
+			nav.Prev = &navItem{Title: s.pages[i-1].title, URL: navURL(dir, s.pages[i-1].file)}
+		}
+		if i < len(s.pages)-1 {
+			nav.Next = &navItem{Title: s.pages[i+1].title, URL: navURL(dir, s.pages[i+1].file)}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return nav
+}
+
+// updateServedNav rebuilds the site navigation of the served folder.
+func updateServedNav() {
+	if !navigation {
+		return
+	}
+	s, err := findSiteNav(serveDir, []string{"**/*.md"})
+	if err != nil {
+		try(err, "Problem building the site navigation.")
+		return
+	}
+	servedNav.mu.Lock()
+	servedNav.site = s
+	servedNav.mu.Unlock()
+}
+
+// servedSite returns the site navigation of the served folder (nil if not used).
+func servedSite() *siteNav {
+	servedNav.mu.RLock()
+	defer servedNav.mu.RUnlock()
+	return servedNav.site
+}
+
+// serveSiteNav returns the site navigation of the served .md filename.
+func serveSiteNav(filename string) *pageNav {
+	if !navigation {
+		return nil
+	}
+	file, err := filepath.Rel(serveDir, filename)
+	if err != nil {
+		return nil
+	}
+	return servedSite().page(file)
+}
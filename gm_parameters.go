@@ -3,20 +3,14 @@ package main
 import (
 	"errors"
 	"fmt"
-	"html/template"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
-	chroma "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/kpym/gm/render"
 	"github.com/spf13/pflag"
-	"github.com/yuin/goldmark"
-	emoji "github.com/yuin/goldmark-emoji"
-	highlighting "github.com/yuin/goldmark-highlighting/v2"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer"
-	"github.com/yuin/goldmark/renderer/html"
 )
 
 // Display the usage help message
@@ -30,15 +24,48 @@ func help() {
   If not serving (no '--serve' or '-s' option is used):
   - the .md files are converted and saved as .html with the same base name;
   - if the corresponding .html file already exists, it is overwritten;
+  - with an output folder, the unchanged files (with the same configuration) are skipped, except with '--force'
+    (the hashes are kept in '.gm-cache' in the output folder);
   - 'stdin' is converted to 'stdout';
   - when a pattern is used, only the matched .md files are considered.
-  - the pattern can contain '*', '?', the '**' glob pattern, '[class]' and {alt1,...} alternatives.
-
-  When serving (with '--serve' or '-s' option):
-  - the .md files are converted and served as html with live.js (for live updates);
+  - the pattern can contain '*', '?', the '**' glob pattern, '[class]' and {alt1,...} alternatives;
+  - with '--sitemap' the built pages are listed in 'sitemap.xml' (and 'robots.txt' is added if missing);
+  - with '--watch' the matched files are rebuilt when changed (non .md files are copied, not moved).
+
+  When serving (with 'gm serve [path]', '--serve' or '-s' option):
+  - the .md files are converted and served as html, reloaded when their sources change;
+  - the urls and the links are the ones of the build ('xxx.html' for 'xxx.md', README.md as index.html with '--readme-index');
+  - with '--built' all the .md files are built in memory and only the output tree is served;
   - all other files are staticly served;
   - nothing is written on the disk.
 
+  Checking links (with 'gm check [pattern]...'):
+  - the matched .md files (all by default) are compiled in memory, nothing is written on the disk;
+  - the broken local links, missing images and unknown #anchors are printed as 'file:line: problem';
+  - the return status is 1 if some problem is found.
+
+  Writing feeds (with 'gm feed pattern...'):
+  - the matched .md files are the posts of 'atom.xml' and 'rss.xml' written in the output folder;
+  - the post dates are the front matter 'date' (and 'lastmod') or the file modification time;
+  - the site url is set by '--feed-url' (or '--sitemap').
+
+  Render api (with 'gm api'):
+  - 'POST /render' converts the markdown request body and returns the html page (or '?fragment=true' for the html code only);
+  - the query can set 'title', 'css' (repeated) and any 'gm-*' goldmark option, like '/render?gm-math=true';
+  - 'POST /render/batch' converts a json array of {"markdown", "title", "css", "fragment"} objects
+    and returns a json array of {"html", "title", "error"} objects;
+  - the server listens on '--host' and '--port' ('--tls' is also available).
+
+  Exit status:
+  - 0 when everything was done, 1 on failure (the build stops at the first failed file) or when problems are found by 'gm check';
+  - 2 for wrong flags or parameters;
+  - 3 with '--keep-going', when some files failed but the others were done.
+
+  Configuration file:
+  - all options can be set in 'gm.yaml', 'gm.yml' or 'gm.toml' in the current folder (or the '--config' file);
+  - the command line flags win over the configuration file values;
+  - 'gm config dump' prints the effective configuration.
+
 `
 	fmt.Fprintf(out, header, version, goldmarkVersion)
 	pflag.PrintDefaults()
@@ -47,10 +74,18 @@ func help() {
 
 var (
 	// serve flags
-	serve     bool
-	serveDir  string
-	serveFile string
-	timeout   int
+	serve      bool
+	servebuilt bool
+	serveDir   string
+	serveFile  string
+	timeout    int
+	serveHost  string
+	servePort  int
+	noOpen     bool
+	browserCmd string
+	useTLS     bool
+	certFile   string
+	keyFile    string
 
 	// build flags
 	outdir     string
@@ -59,20 +94,35 @@ var (
 	move       bool
 	skipdot    bool
 	pages      bool
+	watch      bool
+	force      bool
+	keepGoing  bool
+	jobs       int
+	selfcont   bool
+	sitemapURL string
+	navigation bool
+
+	// feed flags
+	feedURL   string
+	feedTitle string
 
 	// template flags
-	css        []string
-	title      string
-	favicon    string
-	htmlshell  string
-	liveupdate bool
-
-	mdTemplate *template.Template
+	css       []string
+	title     string
+	favicon   string
+	htmlshell string
+	// the template file (if any), reloaded when serving
+	templateFile string
+	liveupdate   bool
 
 	// the GoldMark flags
 	attribute      bool
 	definitionList bool
 	footnote       bool
+	fnPrefix       string
+	fnBacklink     string
+	fnTitle        string
+	fnClass        string
 	linkify        bool
 	strikethrough  bool
 	table          bool
@@ -85,35 +135,63 @@ var (
 	xhtml          bool
 	chromatheme    string
 	chromalines    bool
+	math           bool
+	subSup         bool
+	mark           bool
+	ins            bool
+	abbr           bool
+	tocMin         int
+	tocMax         int
 	// The following goldmark options are missing:
-	// - Subscript / Superscript
-	// - Ins
-	// - Mark
-	// - Inline footnote
 	// - Compact style definition lists
-	// - Abbreviations
-	// - Math rendering
-
-	mdParser goldmark.Markdown
 
 	// post GoldMark flags
 	localmdlinks bool
+	sourcepos    bool
 
 	// info flags
 	quiet    bool
 	showhelp bool
 	info     func(string, ...interface{})
 
+	// config flags
+	configFile string
+
 	// regex flags
 	reMd   []string
 	reHtml []string
+	// the decoded regex rules
+	reMdRules   render.SubstRuleList
+	reHtmlRules render.SubstRuleList
+
+	// the command (if any) and the other positional parameters
+	command string
+	args    []string
 )
 
+// commands are the first positional parameters that are not file patterns
+var commands = map[string]bool{
+	"config": true,
+	"check":  true,
+	"feed":   true,
+	"serve":  true,
+	"api":    true,
+}
+
 // SetParameters configure the global variables from the command line flags.
-func SetParameters() {
+// The usage errors are marked (see usage).
+func SetParameters() error {
 	pflag.BoolVarP(&serve, "serve", "s", false, "Start serving local .md file(s). No html is saved.")
 	pflag.Lookup("serve").NoOptDefVal = "true"
-	pflag.IntVar(&timeout, "timeout", 0, "Timeout in seconds for stop serving if no (non static) request. Default is 0 (no timeout).")
+	pflag.StringVar(&serveHost, "host", "localhost", "The host to serve on, like 0.0.0.0 for all the interfaces, or a unix socket path like unix:/tmp/gm.sock.")
+	pflag.IntVar(&servePort, "port", 0, "The port to serve on. Default is 0 (the first available from 8080).")
+	pflag.BoolVar(&servebuilt, "built", false, "When serving, build all the .md files in memory and serve the output tree (as published by the build).")
+	pflag.BoolVar(&noOpen, "no-open", false, "Do not open the served url in the web browser.")
+	pflag.StringVar(&browserCmd, "browser", "", "The command opening the served url (added as last argument or replacing %s). Default is the system browser.")
+	pflag.BoolVar(&useTLS, "tls", false, "Serve over https, with a self-signed certificate (cached in the user cache folder) if no --cert/--key.")
+	pflag.StringVar(&certFile, "cert", "", "The TLS certificate file used to serve over https (implies --tls).")
+	pflag.StringVar(&keyFile, "key", "", "The TLS key file used to serve over https (implies --tls).")
+	pflag.IntVar(&timeout, "timeout", 0, "Timeout in seconds for stop serving if no page is open. Default is 0 (no timeout).")
 
 	pflag.StringArrayVarP(&css, "css", "c", []string{"github"}, "A css content or url or the theme name present in github.com/kpym/markdown-css. Multiple values are allowed.")
 	pflag.StringVarP(&title, "title", "t", "", "The page title. If empty, search for <h1> in the resulting html.")
@@ -121,16 +199,30 @@ func SetParameters() {
 	pflag.StringVar(&htmlshell, "html", "", "The html template (file or string).")
 
 	pflag.StringVarP(&outdir, "out-dir", "o", "", "The build output folder (created if not already existing, not used when serving).")
-	pflag.BoolVar(&readme, "readme-index", false, "Compile README.md to index.html (not used when serving).")
+	pflag.BoolVar(&readme, "readme-index", false, "Compile README.md to index.html.")
 	pflag.BoolVar(&move, "move-no-md", false, "Move all non markdown non dot files to the output folder (not used when serving).")
-	pflag.BoolVar(&skipdot, "skip-dot", false, "Skip dot files (not used when serving).")
+	pflag.BoolVar(&skipdot, "skip-dot", false, "Skip dot files.")
 	pflag.BoolVar(&pages, "pages", false, "Shortcut for --outdir='public' --readme-index --move-no-md --skip-dot (not used when serving).")
-	pflag.BoolVar(&localmdlinks, "links-md2html", true, "Replace .md with .html in links to local files (not used when serving).")
+	pflag.BoolVarP(&watch, "watch", "w", false, "After the build, watch the matched files and rebuild them on change (not used when serving).")
+	pflag.BoolVar(&force, "force", false, "Rebuild all files, even if unchanged since the last build (not used when serving).")
+	pflag.BoolVarP(&keepGoing, "keep-going", "k", false, "Build (or check) all the possible files when some fail, and list the failed ones at the end.")
+	pflag.IntVarP(&jobs, "jobs", "j", 0, "The number of files built concurrently. Default is 0 (GOMAXPROCS). Not used when serving.")
+	pflag.BoolVar(&selfcont, "self-contained", false, "Inline the css (embedded themes included), the favicon and the local images in the html.")
+	pflag.BoolVar(&navigation, "nav", false, "Compute the site navigation (.nav, .prev and .next in the template) from all the matched .md files.")
+	pflag.StringVar(&sitemapURL, "sitemap", "", "The site base url. If set, sitemap.xml and robots.txt (if missing) are written in the output folder (not used when serving).")
+	pflag.StringVar(&feedURL, "feed-url", "", "The site base url used by 'gm feed'. Default is the '--sitemap' value.")
+	pflag.StringVar(&feedTitle, "feed-title", "", "The feed title used by 'gm feed'. Default is the current folder name.")
+	pflag.BoolVar(&sourcepos, "sourcepos", false, "Add data-sourcepos=\"line:col-line:col\" attributes to the block elements (for editor and preview sync).")
+	pflag.BoolVar(&localmdlinks, "links-md2html", true, "Replace .md with .html in links to local files.")
 
 	pflag.BoolVar(&attribute, "gm-attribute", true, "goldmark option: allows to define attributes on some elements.")
 	pflag.BoolVar(&autoHeadingId, "gm-auto-heading-id", true, "goldmark option: enables auto heading ids.")
 	pflag.BoolVar(&definitionList, "gm-definition-list", true, "goldmark option: enables definition lists.")
-	pflag.BoolVar(&footnote, "gm-footnote", true, "goldmark option: enables footnotes.")
+	pflag.BoolVar(&footnote, "gm-footnote", true, "goldmark option: enables footnotes (including inline ones like ^[note]).")
+	pflag.StringVar(&fnPrefix, "gm-footnote-prefix", "", "goldmark option: the prefix of the footnote ids (to avoid collisions when several documents are in the same page).")
+	pflag.StringVar(&fnBacklink, "gm-footnote-backlink", "&#x21a9;&#xfe0e;", "goldmark option: the html of the footnote backlinks.")
+	pflag.StringVar(&fnTitle, "gm-footnote-title", "", "goldmark option: the title of the footnotes section.")
+	pflag.StringVar(&fnClass, "gm-footnote-class", "footnotes", "goldmark option: the class of the footnotes section.")
 	pflag.BoolVar(&linkify, "gm-linkify", true, "goldmark option: activates auto links.")
 	pflag.BoolVar(&strikethrough, "gm-strikethrough", true, "goldmark option: enables strike through.")
 	pflag.BoolVar(&table, "gm-table", true, "goldmark option: enables tables.")
@@ -139,17 +231,26 @@ func SetParameters() {
 	pflag.BoolVar(&emojis, "gm-emoji", true, "goldmark option: enables (github) emojis 💪.")
 	pflag.BoolVar(&unsafe, "gm-unsafe", true, "goldmark option: enables raw html.")
 
+	pflag.BoolVar(&math, "gm-math", false, "goldmark option: enables $inline$ and $$display$$ math (rendered by KaTeX in the default template).")
+	pflag.BoolVar(&subSup, "gm-sub-sup", false, "goldmark option: enables ~subscript~ and ^superscript^.")
+	pflag.BoolVar(&mark, "gm-mark", false, "goldmark option: enables ==marked text==.")
+	pflag.BoolVar(&ins, "gm-ins", false, "goldmark option: enables ++inserted text++.")
+	pflag.BoolVar(&abbr, "gm-abbr", false, "goldmark option: enables abbreviations defined by lines like '*[HTML]: Hyper Text Markup Language'.")
 	pflag.BoolVar(&hardWraps, "gm-hard-wraps", false, "goldmark option: render newlines as <br>.")
 	pflag.BoolVar(&xhtml, "gm-xhtml", false, "goldmark option: render as XHTML.")
 
 	pflag.StringVar(&chromatheme, "gm-highlighting", "github", "goldmark option: the code highlighting theme (empty string to disable).\nCheck github.com/alecthomas/chroma for theme names.")
 	pflag.BoolVar(&chromalines, "gm-line-numbers", false, "goldmark option: enable line numering for code highlighting.")
 
+	pflag.IntVar(&tocMin, "toc-min", 1, "The minimal heading level in the table of contents (.toc in the template, [TOC] or [[_TOC_]] in the markdown).")
+	pflag.IntVar(&tocMax, "toc-max", 6, "The maximal heading level in the table of contents.")
+
 	pflag.StringArrayVar(&reMd, "re-md", []string{}, "Apply regex substitution on the markdown source before conversion.")
 	pflag.StringArrayVar(&reHtml, "re-html", []string{}, "Apply regex substitution on the HTML output after conversion.")
 
 	pflag.BoolVarP(&quiet, "quiet", "q", false, "No errors and no info is printed. Return error code is still available.")
 	pflag.BoolVarP(&showhelp, "help", "h", false, "Print this help message.")
+	pflag.StringVar(&configFile, "config", "", "The configuration file (yaml or toml). If empty, search for gm.yaml, gm.yml or gm.toml in the current folder.")
 	// keep the flags order
 	pflag.CommandLine.SortFlags = false
 	// in case of error do not display second time
@@ -160,34 +261,51 @@ func SetParameters() {
 	// display the help message if the flag is set or if there is an error
 	if showhelp || err != nil {
 		pflag.Usage()
-		check(err, "Problem parsing parameters.")
-		os.Exit(0)
+		if err != nil {
+			return usage(fail(err, "Problem parsing parameters."))
+		}
+		os.Exit(exitOK)
+	}
+
+	// merge the configuration file values (if any)
+	config := findConfigFile()
+	if config != "" {
+		if err := applyConfig(pflag.CommandLine, config); err != nil {
+			return usage(fail(err, "Problem reading the configuration file", config))
+		}
+	}
+	// the first positional parameter can be a command
+	args = pflag.Args()
+	if len(args) > 0 && commands[args[0]] {
+		command, args = args[0], args[1:]
+	}
+	// print the effective configuration and exit
+	if command == "config" {
+		if len(args) != 1 || args[0] != "dump" {
+			return usage(errors.New("unknown config command (only 'gm config dump' is available)"))
+		}
+		if err := dumpConfig(config); err != nil {
+			return fail(err, "Problem printing the configuration.")
+		}
+		os.Exit(exitOK)
 	}
 
 	// quiet or no
 	if quiet {
 		info = func(format string, a ...interface{}) {}
 	} else {
-		info = func(format string, a ...interface{}) { fmt.Fprintf(os.Stderr, format, a...) }
-	}
-
-	// set the css
-	for i, c := range css {
-		// if not empty and not containing '/' or '.' or '{' it should be a theme name
-		if c != "" && !strings.ContainsAny(c, "/.{") {
-			css[i] = "https://kpym.github.io/markdown-css/" + c + ".min.css"
-		} else if strings.Contains(c, "{") {
-			css[i] = "<style>" + c + "</style>"
+		info = func(format string, a ...interface{}) {
+			printMutex.Lock()
+			defer printMutex.Unlock()
+			fmt.Fprintf(os.Stderr, format, a...)
 		}
 	}
+
 	// set the template
-	t, err := os.ReadFile(htmlshell)
-	if err == nil {
-		htmlshell = string(t)
-	}
-	if htmlshell == "" {
-		htmlshell = defaultHTMLTemplate
+	if fi, err := os.Stat(htmlshell); err == nil && fi.Mode().IsRegular() {
+		templateFile = htmlshell
 	}
+	htmlshell = render.ReadTemplate(htmlshell)
 
 	//set flags from shortcuts
 	if pages {
@@ -200,39 +318,51 @@ func SetParameters() {
 	}
 
 	// Initialize regex rules
-	reMdRules, err = DecodeRules(strings.Join(reMd, "\n"))
+	reMdRules, err = render.DecodeRules(strings.Join(reMd, "\n"))
 	if err != nil {
-		check(err, "Failed to initialize re-md rules.")
+		return usage(fail(err, "Failed to initialize re-md rules."))
 	}
-	reHtmlRules, err = DecodeRules(strings.Join(reHtml, "\n"))
+	reHtmlRules, err = render.DecodeRules(strings.Join(reHtml, "\n"))
 	if err != nil {
-		check(err, "Failed to initialize re-html rules.")
+		return usage(fail(err, "Failed to initialize re-html rules."))
 	}
 
-	if serve {
-		setServeParameters()
-	} else {
-		setBuildParameters()
+	switch {
+	case command == "check":
+		err = setCheckParameters()
+	case command == "feed":
+		err = setFeedParameters()
+	case command == "api":
+		err = setAPIParameters()
+	case command == "serve" || serve:
+		serve = true
+		err = setServeParameters()
+	default:
+		err = setBuildParameters()
+	}
+	if err != nil {
+		return err
 	}
 
-	setTemplate()
-	setGoldMark()
+	return setConverter()
 }
 
 // setServeParameters prepare the parameters to serve.
 // if the positional parameter is like `path/file.md` then `path/` is served and `/file.md` is requested
 // if the positional parameter is like `path/folder/` then `path/folder` is served and `/` is requested
-func setServeParameters() {
-	if pflag.NArg() > 1 {
-		check(errors.New("only one file or folder can be specified for serving"))
+func setServeParameters() error {
+	if len(args) > 1 {
+		return usage(errors.New("only one file or folder can be specified for serving"))
 	}
 
 	filename := "."
-	if pflag.NArg() > 0 {
-		filename = pflag.Arg(0)
+	if len(args) > 0 {
+		filename = args[0]
 	}
 	fi, err := os.Stat(filename)
-	check(err, "Can't access file or folder named", filename)
+	if err != nil {
+		return usage(fail(err, "Can't access file or folder named", filename))
+	}
 	switch mode := fi.Mode(); {
 	case mode.IsDir():
 		serveDir = filename
@@ -241,17 +371,46 @@ func setServeParameters() {
 		serveDir = filepath.Dir(filename)
 		serveFile = filepath.Base(filename)
 	default:
-		check(fmt.Errorf("the specified path '%s'is not a file or folder", filename))
+		return usage(fmt.Errorf("the specified path '%s'is not a file or folder", filename))
+	}
+
+	// insert the reload script in the template
+	// (the built pages get it when served, as they should be the same as the published ones)
+	liveupdate = !servebuilt
+
+	return setTLSParameters()
+}
+
+// setTLSParameters sets the https certificate (if any).
+func setTLSParameters() error {
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return usage(errors.New("both --cert and --key should be provided"))
+		}
+		useTLS = true
+	} else if useTLS {
+		var err error
+		certFile, keyFile, err = selfSignedCert(serveHost)
+		return fail(err, "Problem generating the self-signed certificate.")
 	}
+	return nil
+}
 
-	// insert live.js in the template
-	liveupdate = true
+// setAPIParameters prepare the parameters of the render api server.
+func setAPIParameters() error {
+	if len(args) > 0 {
+		return usage(errors.New("no positional parameter is expected by 'gm api'"))
+	}
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	return setTLSParameters()
 }
 
 // setBuildParameters get all patterns and create (if necessary) the "out dir".
-func setBuildParameters() {
+func setBuildParameters() error {
 	// get the positional parameters
-	inpatterns = pflag.Args()
+	inpatterns = args
 	// check for positional parameters
 	if len(inpatterns) == 0 {
 		// check if there is a pipeed input
@@ -260,7 +419,7 @@ func setBuildParameters() {
 			inpatterns = append(inpatterns, "stdin")
 		} else {
 			pflag.Usage()
-			check(errors.New("at least one input 'file.md', 'p*ttern' or 'stdin' should be provided"))
+			return usage(errors.New("at least one input 'file.md', 'p*ttern' or 'stdin' should be provided"))
 		}
 	}
 
@@ -268,84 +427,115 @@ func setBuildParameters() {
 	if outdir != "" {
 		outdir = filepath.Clean(outdir)
 		if os.MkdirAll(outdir, os.ModePerm) != nil {
-			check(fmt.Errorf("the specified output folder '%s' is not reachable", outdir))
+			return usage(fmt.Errorf("the specified output folder '%s' is not reachable", outdir))
 		}
 	}
-}
 
-// setGoldMark creates a new markdown parser with configuration based on the parameter flags.
-// The code is borrowed from: https://github.com/gohugoio/hugo/blob/d90e37e0c6e812f9913bf256c9c81aa05b7a08aa/markup/goldmark/convert.go
-func setGoldMark() {
-	var (
-		goldmarkOptions []goldmark.Option
-		rendererOptions []renderer.Option
-		extensions      []goldmark.Extender
-		parserOptions   []parser.Option
-	)
-
-	if autoHeadingId {
-		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
-	}
-	if definitionList {
-		extensions = append(extensions, extension.DefinitionList)
-	}
-	if footnote {
-		extensions = append(extensions, extension.Footnote)
-	}
-	if linkify {
-		extensions = append(extensions, extension.Linkify)
-	}
-	if strikethrough {
-		extensions = append(extensions, extension.Strikethrough)
-	}
-	if table {
-		extensions = append(extensions, extension.Table)
-	}
-	if taskList {
-		extensions = append(extensions, extension.TaskList)
-	}
-	if typographer {
-		extensions = append(extensions, extension.Typographer)
+	// check the sitemap base url
+	if sitemapURL != "" {
+		if u, err := url.Parse(sitemapURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return usage(fmt.Errorf("the sitemap base url '%s' should be absolute, like 'https://example.com/'", sitemapURL))
+		}
 	}
-	if emojis {
-		extensions = append(extensions, emoji.Emoji)
+	return nil
+}
+
+// setCheckParameters get all patterns to check (all .md files by default).
+func setCheckParameters() error {
+	inpatterns = args
+	if len(inpatterns) == 0 {
+		inpatterns = []string{"**/*.md"}
 	}
-	if attribute {
-		parserOptions = append(parserOptions, parser.WithAttribute())
+	return nil
+}
+
+// setFeedParameters get the post patterns, the site url and the output folder.
+func setFeedParameters() error {
+	inpatterns = args
+	if len(inpatterns) == 0 {
+		return usage(errors.New("at least one post pattern should be provided, like 'gm feed \"posts/*.md\"'"))
 	}
-	if unsafe {
-		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	if feedURL == "" {
+		feedURL = sitemapURL
 	}
-	if hardWraps {
-		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	if u, err := url.Parse(feedURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return usage(fmt.Errorf("the feed base url '%s' should be absolute, like 'https://example.com/' (use '--feed-url')", feedURL))
 	}
-	if xhtml {
-		rendererOptions = append(rendererOptions, html.WithXHTML())
+	outdir = filepath.Clean(outdir)
+	if os.MkdirAll(outdir, os.ModePerm) != nil {
+		return usage(fmt.Errorf("the specified output folder '%s' is not reachable", outdir))
 	}
+	return nil
+}
 
-	if chromatheme != "" {
-		var chromaOptions []chroma.Option
-		chromaOptions = append(chromaOptions, chroma.WithLineNumbers(chromalines))
-
-		extensions = append(extensions, highlighting.NewHighlighting(
-			highlighting.WithStyle(chromatheme),
-			highlighting.WithFormatOptions(chromaOptions...),
-		))
+// renderOptions returns the conversion options set by the flags.
+func renderOptions() render.Options {
+	return render.Options{
+		Attribute:        attribute,
+		AutoHeadingID:    autoHeadingId,
+		DefinitionList:   definitionList,
+		Footnote:         footnote,
+		FootnotePrefix:   fnPrefix,
+		FootnoteBacklink: fnBacklink,
+		FootnoteTitle:    fnTitle,
+		FootnoteClass:    fnClass,
+		Linkify:          linkify,
+		Strikethrough:    strikethrough,
+		Table:            table,
+		TaskList:         taskList,
+		Typographer:      typographer,
+		Emoji:            emojis,
+		Unsafe:           unsafe,
+		HardWraps:        hardWraps,
+		XHTML:            xhtml,
+		Math:             math,
+		SubSup:           subSup,
+		Mark:             mark,
+		Ins:              ins,
+		Abbr:             abbr,
+		Highlighting:     chromatheme,
+		LineNumbers:      chromalines,
+		TOCMin:           tocMin,
+		TOCMax:           tocMax,
+		SourcePos:        sourcepos,
+		Title:            title,
+		Favicon:          favicon,
+		CSS:              css,
+		Template:         htmlshell,
+		MarkdownRules:    reMdRules,
+		HTMLRules:        reHtmlRules,
+
+		// the files are local: the front matter can set the template file
+		FrontMatterTemplate: true,
 	}
+}
 
-	goldmarkOptions = append(
-		goldmarkOptions,
-		goldmark.WithExtensions(extensions...),
-		goldmark.WithParserOptions(parserOptions...),
-		goldmark.WithRendererOptions(rendererOptions...),
-	)
-
-	mdParser = goldmark.New(goldmarkOptions...)
+// setConverter builds the converter from the flags.
+// When serving, a template parsing error is shown in the browser (see reloadTemplate).
+func setConverter() error {
+	options := renderOptions()
+	c, err := render.New(options)
+	if err != nil && serve {
+		templateErr = err
+		options.Template = ""
+		c, err = render.New(options)
+	}
+	if err != nil {
+		return usage(fail(err, "Problem parsing the HTML template."))
+	}
+	converter = c
+	return nil
 }
 
-// setTemplate parse the `html` flag to template.
-func setTemplate() {
-	var err error
-	mdTemplate, err = template.New("md").Parse(htmlshell)
-	check(err, "Problem parsing the HTML template.")
+// reloadTemplate reads and parses again the template file (when serving).
+func reloadTemplate() {
+	templateMutex.Lock()
+	defer templateMutex.Unlock()
+	htmlshell = render.ReadTemplate(templateFile)
+	c, err := render.New(renderOptions())
+	if err != nil {
+		templateErr = err
+		return
+	}
+	converter, templateErr = c, nil
 }
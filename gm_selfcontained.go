@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kpym/gm/render"
+)
+
+// httpClient is used to download the remote resources
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// regexes used to find the resources to inline
+var (
+	regexStylesheet = regexp.MustCompile(`(?i)<link\b[^>]*\brel\s*=\s*"stylesheet"[^>]*>`)
+	regexIcon       = regexp.MustCompile(`(?i)<link\b[^>]*\brel\s*=\s*"(?:shortcut )?icon"[^>]*>`)
+	regexImg        = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	regexSrcHref    = regexp.MustCompile(`(?i)\b(?:src|href)\s*=\s*"([^"]*)"`)
+)
+
+// readResource returns the content of an embedded theme, a remote url
+// or a local file (relative to dir). The local files are recorded in deps (if not nil).
+func readResource(src, dir string, deps *fileDeps) ([]byte, error) {
+	if strings.HasPrefix(src, render.ThemeURL) {
+		if content, err := themesFS.ReadFile("themes/" + strings.TrimPrefix(src, render.ThemeURL)); err == nil {
+			return content, nil
+		}
+	}
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		resp, err := httpClient.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	// a local file, without query and fragment
+	name, err := url.PathUnescape(strings.SplitN(strings.SplitN(src, "#", 2)[0], "?", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+	}
+	deps.add(name)
+	return os.ReadFile(name)
+}
+
+// dataURI encodes the content of src as data uri.
+func dataURI(src string, content []byte) string {
+	ext := path.Ext(strings.SplitN(strings.SplitN(src, "#", 2)[0], "?", 2)[0])
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType == "" {
+		mimeType = http.DetectContentType(content)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(content)
+}
+
+// inlineAttribute replaces the src (or href) value of the tag by a data uri.
+func inlineAttribute(tag []byte, dir string, deps *fileDeps) []byte {
+	return regexSrcHref.ReplaceAllFunc(tag, func(attr []byte) []byte {
+		src := string(regexSrcHref.FindSubmatch(attr)[1])
+		if src == "" || strings.HasPrefix(src, "data:") {
+			return attr
+		}
+		content, err := readResource(src, dir, deps)
+		if err != nil {
+			try(err, "Can't inline", src)
+			return attr
+		}
+		name := strings.SplitN(string(attr), "=", 2)[0]
+		return []byte(name + `="` + dataURI(src, content) + `"`)
+	})
+}
+
+// selfContain inlines in the html all the stylesheets, the favicon and the images.
+// The relative paths are relative to dir.
+// If a resource can't be read it is kept as link, except for the themes that are expected to be inlined.
+// The inlined local files are recorded in deps (if not nil).
+func selfContain(html []byte, dir string, deps *fileDeps) ([]byte, error) {
+	var themeErr error
+	html = regexStylesheet.ReplaceAllFunc(html, func(tag []byte) []byte {
+		m := regexSrcHref.FindSubmatch(tag)
+		if m == nil {
+			return tag
+		}
+		src := string(m[1])
+		content, err := readResource(src, dir, deps)
+		if err != nil && strings.HasPrefix(src, render.ThemeURL) {
+			if themeErr == nil {
+				themeErr = fmt.Errorf("can't inline the theme %s: %w", src, err)
+			}
+			return tag
+		}
+		if err != nil {
+			try(err, "Can't inline", src)
+			return tag
+		}
+		return []byte("<style>\n" + string(content) + "\n</style>")
+	})
+	if themeErr != nil {
+		return nil, themeErr
+	}
+	html = regexIcon.ReplaceAllFunc(html, func(tag []byte) []byte {
+		return inlineAttribute(tag, dir, deps)
+	})
+	html = regexImg.ReplaceAllFunc(html, func(tag []byte) []byte {
+		return inlineAttribute(tag, dir, deps)
+	})
+	return html, nil
+}
@@ -2,25 +2,23 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	"github.com/kpym/gm/internal/browser"
 )
 
-// availablePort provides the first available port after 8080
+// availablePort provides the first available port after 8080 on host
 // or 8180 if no available ports are present.
-func availablePort() (port string) {
+func availablePort(host string) (port string) {
 	for i := 8080; i < 8181; i++ {
 		port = strconv.Itoa(i)
-		if ln, err := net.Listen("tcp", "localhost:"+port); err == nil {
+		if ln, err := net.Listen("tcp", net.JoinHostPort(host, port)); err == nil {
 			ln.Close()
 			break
 		}
@@ -28,111 +26,210 @@ func availablePort() (port string) {
 	return port
 }
 
+// isUnixSocket checks if the host is a unix socket path (like `unix:/tmp/gm.sock` or `/tmp/gm.sock`).
+func isUnixSocket(host string) bool {
+	return strings.HasPrefix(host, "unix:") || strings.ContainsRune(host, '/')
+}
+
+// listen starts listening on the `--host` and `--port` address.
+// The url scheme is https with `--tls`.
+// It returns the listener and the base url to visit.
+func listen() (net.Listener, string, error) {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	if isUnixSocket(serveHost) {
+		socket := strings.TrimPrefix(serveHost, "unix:")
+		// remove the socket left by a previous run
+		if fi, err := os.Stat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(socket)
+		}
+		ln, err := net.Listen("unix", socket)
+		return ln, scheme + "://localhost/", err
+	}
+	port := strconv.Itoa(servePort)
+	if servePort == 0 {
+		port = availablePort(serveHost)
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(serveHost, port))
+	if err != nil {
+		return nil, "", err
+	}
+	// the wildcard addresses are visited locally
+	host := serveHost
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return ln, scheme + "://" + net.JoinHostPort(host, port) + "/", nil
+}
+
+// readmeFile returns the README.md file of the folder dir (whatever the case), if any.
+func readmeFile(dir string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.ToLower(e.Name()) == "readme.md" {
+			return filepath.Join(dir, e.Name()), true
+		}
+	}
+	return "", false
+}
+
+// sourceFile returns the .md file rendered at the url path, if any.
+// The urls are the ones of the build output: `xxx.html` for `xxx.md`,
+// and `index.html` (or the folder) for `README.md` with `--readme-index`.
+// The .md files can also be requested directly.
+func sourceFile(urlPath string) (string, bool) {
+	filename := filepath.Join(serveDir, filepath.FromSlash(urlPath))
+	if strings.HasSuffix(urlPath, "/") {
+		filename = filepath.Join(filename, "index.html")
+	}
+	exists := func(name string) bool {
+		fi, err := os.Stat(name)
+		return err == nil && fi.Mode().IsRegular()
+	}
+	if strings.HasSuffix(filename, ".md") {
+		return filename, exists(filename)
+	}
+	if !strings.HasSuffix(filename, ".html") {
+		return "", false
+	}
+	// try first the corresponding .md file
+	if md := filename[:len(filename)-5] + ".md"; exists(md) {
+		return md, true
+	}
+	if readme && filepath.Base(filename) == "index.html" && !exists(filename) {
+		return readmeFile(filepath.Dir(filename))
+	}
+	return "", false
+}
+
+// serveMarkdown sends the html compiled from the .md filename (or the error page).
+func serveMarkdown(w http.ResponseWriter, filename string) {
+	// the errors are shown in the browser
+	file, _ := filepath.Rel(serveDir, filename)
+	markdown, err := os.ReadFile(filename)
+	if err != nil {
+		serveError(w, file, fmt.Errorf("problem reading the markdown: %w", err))
+		return
+	}
+	html, err := buildPage(markdown, filepath.Dir(filename), serveSiteNav(filename), nil)
+	if err != nil {
+		serveError(w, file, err)
+		return
+	}
+	events.setResources(filename, html)
+	info(" serve converted .md file.")
+	w.Write(html)
+}
+
 // serveFiles serve the local folder `serveDir`.
 // If an .md (or corresponding .html) file is requested it is compiled and send as html.
-func serveFiles() {
+// The open pages are reloaded by Server-Sent Events when their sources change.
+func serveFiles() error {
 	var lastMethodPath string
-	var ticker *time.Ticker      // used to exit if no request is received for timeout seconds
-	var exit atomic.Bool         // is set to true on every request and reset to false on every tick of the ticker
-	var livejsactive atomic.Bool // is set to true if the last request was for non static content
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// say that we are alive
-		exit.Store(false)
-		// by default live.js is active (serving .md or related files)
-		// it is reset to false if the request is for static content later
-		livejsactive.Store(true)
 		// how should I print the info?
-		filename := filepath.Join(serveDir, r.URL.Path)
 		newMethodPath := fmt.Sprintf("\n%s '%s':", r.Method, r.URL.Path)
 		if newMethodPath != lastMethodPath {
 			lastMethodPath = newMethodPath
 			info(newMethodPath)
 		}
-		// serve the file
-		if strings.HasSuffix(filename, ".html") {
-			// try first to serve the corresponding .md file
-			// if it is not present, serve the .html as static file
-			filename = filename[0:len(filename)-5] + ".md"
+		// serve the compiled output from memory
+		if servebuilt {
+			built.ServeHTTP(w, r)
+			return
 		}
-		if strings.HasSuffix(filename, "md") {
-			if r.Method == "HEAD" {
-				info(".")
-				if fstat, err := os.Stat(filename); err == nil {
-					w.Header().Set("Last-Modified", fstat.ModTime().UTC().Format(http.TimeFormat))
-					w.Header().Set("Content-Type", "text/html")
-					w.Write([]byte{})
-				}
-				return
-			}
-			if content, err := os.Open(filename); err == nil {
-				defer content.Close()
-
-				markdown, err := io.ReadAll(content)
+		// serve the .md file published at this url
+		if filename, ok := sourceFile(r.URL.Path); ok {
+			serveMarkdown(w, filename)
+			return
+		}
+		// serve the folder listing (if there is no index page)
+		filename := filepath.Join(serveDir, r.URL.Path)
+		if fi, err := os.Stat(filename); err == nil && fi.IsDir() && strings.HasSuffix(r.URL.Path, "/") {
+			if _, err := os.Stat(filepath.Join(filename, "index.html")); err != nil {
+				html, err := listingPage(filename, r.URL.Path)
 				if err != nil {
-					check(err, "Problem reading the markdown.")
-				}
-
-				// Apply re-md rules if available
-				if len(reMdRules) > 0 {
-					markdown = reMdRules.Apply(markdown)
-				}
-
-				if html, err := compile(markdown); err == nil {
-					// Apply re-html rules if available
-					if len(reHtmlRules) > 0 {
-						html = reHtmlRules.Apply(html)
-					}
-
-					info(" serve converted .md file.")
-					w.Write(html)
+					serveError(w, r.URL.Path, err)
 					return
 				}
+				events.setResources(filename, html)
+				info(" serve folder listing.")
+				w.Write(html)
+				return
 			}
 		}
-		switch r.URL.Path {
-		case "/favicon.ico":
+		if r.URL.Path == "/favicon.ico" {
 			info(" serve internal png.")
 			w.Header().Set("Cache-Control", "max-age=86400") // 86400 s = 1 day
 			w.Header().Set("Expires", time.Now().Add(24*time.Hour).UTC().Format(http.TimeFormat))
 			w.Write(favIcon)
 			return
-		case "/live.js":
-			info(" serve live.js.")
-			w.Header().Set("Cache-Control", "max-age=86400") // 86400 s = 1 day
-			w.Header().Set("Expires", time.Now().Add(24*time.Hour).UTC().Format(http.TimeFormat))
-			w.Write(livejs)
-			return
 		}
 		info(" serve raw file.")
-		livejsactive.Store(false) // is serving file without live.js
 		w.Header().Set("Cache-Control", "no-store")
 		http.FileServer(http.Dir(serveDir)).ServeHTTP(w, r)
 	})
+	http.HandleFunc("/__gm/reload.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(reloadjs)
+	})
+	http.Handle("/__gm/events", events)
+	http.HandleFunc("/__gm/scroll", events.serveScroll)
+	http.HandleFunc("/__gm/cursor", events.serveCursor)
+	updateServedNav()
+	if servebuilt {
+		built.build()
+	}
+	go func() {
+		// the pages are still served without live reload
+		try(watchServed(), "Problem watching the served files (no live reload).")
+	}()
 
 	// start the exit timer ?
-	if liveupdate && timeout > 0 {
-		// if no livejs request is received in timeout seconds, exit
-		ticker = time.NewTicker(time.Duration(timeout) * time.Second)
-		defer ticker.Stop()
+	if timeout > 0 {
+		// if no page is open for timeout seconds, exit
 		go func() {
-			for {
-				// wait for timeout seconds
-				<-ticker.C
-				// check if the last request was more than timeout seconds ago
-				// and if it was for non static content, so that live.js should be active
-				if exit.Swap(true) && livejsactive.Load() {
-					info("\nNo request for %d seconds. Exit.\n\n", timeout)
-					mainEnd()
+			for range time.Tick(time.Second) {
+				if events.idle() > time.Duration(timeout)*time.Second {
+					info("\nNo open page for %d seconds. Exit.\n\n", timeout)
+					mainEnd(nil)
 				}
 			}
 		}()
 	}
 
-	port := availablePort()
-	info("start serving '%s' folder to localhost:%s.\n", serveDir, port)
-	url := "http://localhost:" + port + "/" + serveFile
-	err := browser.Open(url)
-	try(err, "Can't open the web browser, but you can visit now:", url)
-	check(http.ListenAndServe("localhost:"+port, nil))
+	ln, base, err := listen()
+	if err != nil {
+		return fail(err, "Can't listen on", serveHost)
+	}
+	url := base + serveFile
+	if servebuilt && strings.HasSuffix(serveFile, ".md") {
+		url = base + filepath.ToSlash(htmlName(serveFile))
+	}
+	info("start serving '%s' folder to %s.\n", serveDir, ln.Addr())
+	// the machine-parseable line with the url to visit (printed even with --quiet)
+	printMutex.Lock()
+	if ln.Addr().Network() == "unix" {
+		fmt.Printf("GM_SOCKET=%s\n", ln.Addr())
+	}
+	fmt.Printf("GM_URL=%s\n", url)
+	printMutex.Unlock()
+	switch {
+	case noOpen || ln.Addr().Network() == "unix":
+	case browserCmd != "":
+		try(browser.OpenWith(browserCmd, url), "Can't open the web browser, but you can visit now:", url)
+	default:
+		try(browser.Open(url), "Can't open the web browser, but you can visit now:", url)
+	}
+	if useTLS {
+		return fail(http.ServeTLS(ln, nil, certFile, keyFile), "Problem serving on", ln.Addr())
+	}
+	return fail(http.Serve(ln, nil), "Problem serving on", ln.Addr())
 }
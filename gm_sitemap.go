@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpym/gm/render"
+)
+
+// robotsHeader is the first line of the generated robots.txt,
+// only the files starting with it are overwritten.
+const robotsHeader = "# generated by gm"
+
+// siteMap collects the built pages (with their modification time) for the sitemap.xml.
+// The pages can be added by concurrent builds.
+type siteMap struct {
+	baseURL string
+	pages   map[string]time.Time
+
+	mu sync.Mutex
+}
+
+// sitemap is the current site map (nil if not used)
+var sitemap *siteMap
+
+// sitemapURLSet is the xml sitemap (see https://www.sitemaps.org/protocol.html).
+type sitemapURLSet struct {
+	XMLName xml.Name       `xml:"urlset"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	URLs    []sitemapEntry `xml:"url"`
+}
+
+// sitemapEntry is a page entry of the xml sitemap.
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// newSiteMap returns an empty site map for the baseURL.
+func newSiteMap(baseURL string) *siteMap {
+	return &siteMap{baseURL: strings.TrimSuffix(baseURL, "/") + "/", pages: make(map[string]time.Time)}
+}
+
+// add registers the page built from the .md infile.
+// The modification time is the front matter `lastmod` or `date` if any, and the file one otherwise.
+func (s *siteMap) add(infile string) {
+	if s == nil {
+		return
+	}
+	fi, err := os.Stat(infile)
+	if err != nil {
+		return
+	}
+	lastmod := fi.ModTime()
+	if markdown, err := os.ReadFile(infile); err == nil {
+		if meta, _, err := render.SplitFrontMatter(markdown); err == nil {
+			if t, ok := render.MetaDate(meta, "lastmod"); ok {
+				lastmod = t
+			} else if t, ok := render.MetaDate(meta, "date"); ok {
+				lastmod = t
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[outputName(infile)] = lastmod
+}
+
+// remove unregisters the page built from the .md infile.
+func (s *siteMap) remove(infile string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pages, outputName(infile))
+}
+
+// pageURL returns the url of the outfile on the site at baseURL (ending with a slash).
+// The index.html pages are referenced by their folder.
+func pageURL(baseURL, outfile string) (string, error) {
+	rel, err := filepath.Rel(outdir, outfile)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	loc := strings.Join(parts, "/")
+	if path.Base(loc) == "index.html" {
+		loc = strings.TrimSuffix(loc, "index.html")
+	}
+	return baseURL + loc, nil
+}
+
+// save writes sitemap.xml in the output folder,
+// and robots.txt pointing to it if there is no (not generated) one.
+func (s *siteMap) save() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := sitemapURLSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for outfile, lastmod := range s.pages {
+		loc, err := pageURL(s.baseURL, outfile)
+		if err != nil {
+			return err
+		}
+		set.URLs = append(set.URLs, sitemapEntry{Loc: loc, LastMod: lastmod.UTC().Format(time.RFC3339)})
+	}
+	sort.Slice(set.URLs, func(i, j int) bool { return set.URLs[i].Loc < set.URLs[j].Loc })
+	content, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append([]byte(xml.Header), append(content, '\n')...)
+	if err := os.WriteFile(filepath.Join(outdir, "sitemap.xml"), content, 0644); err != nil {
+		return fmt.Errorf("problem writing sitemap.xml: %w", err)
+	}
+
+	robots := filepath.Join(outdir, "robots.txt")
+	if old, err := os.ReadFile(robots); err == nil && !strings.HasPrefix(string(old), robotsHeader) {
+		return nil
+	}
+	content = []byte(robotsHeader + "\nUser-agent: *\nAllow: /\n\nSitemap: " + s.baseURL + "sitemap.xml\n")
+	if err := os.WriteFile(robots, content, 0644); err != nil {
+		return fmt.Errorf("problem writing robots.txt: %w", err)
+	}
+	return nil
+}
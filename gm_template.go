@@ -1,20 +1,23 @@
 package main
 
+//go:generate go run ./internal/fetchthemes
+
 import (
-	_ "embed"
+	"embed"
 )
 
-// defaultHTMLTemplate is the default value for `html` flag
-//
-//go:embed gm_template.html
-var defaultHTMLTemplate string
-
 // the favicon image for all served pages
 //
 //go:embed md.png
 var favIcon []byte
 
-// modified live.js script to serve locally
+// the script reloading the served pages on change
+//
+//go:embed reload.js
+var reloadjs []byte
+
+// the markdown-css themes, inlined with `--self-contained`
+// (the .min.css files are downloaded by `go generate`)
 //
-//go:embed live.js
-var livejs []byte
+//go:embed themes
+var themesFS embed.FS
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// tempCacheDir makes os.UserCacheDir return a temporary folder (and silences the info messages).
+func tempCacheDir(t *testing.T) {
+	t.Helper()
+	info = func(string, ...interface{}) {}
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LocalAppData", dir)
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	tempCacheDir(t)
+
+	certFile, keyFile, err := selfSignedCert("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate is reused for the same host (and for an address)
+	for _, host := range []string{"localhost", "127.0.0.1", "0.0.0.0"} {
+		if _, _, err := selfSignedCert(host); err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := os.ReadFile(certFile); !bytes.Equal(first, again) {
+			t.Fatalf("the certificate is regenerated for %s", host)
+		}
+	}
+
+	// and regenerated for another host
+	if _, _, err := selfSignedCert("gm.test"); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := os.ReadFile(certFile)
+	if bytes.Equal(first, second) {
+		t.Fatal("the certificate is not regenerated for a new host")
+	}
+	names, ips := certHosts("gm.test")
+	if !validCert(certFile, keyFile, names, ips) {
+		t.Fatalf("the certificate is not valid for %v %v", names, ips)
+	}
+	if names, ips := certHosts("other.test"); validCert(certFile, keyFile, names, ips) {
+		t.Fatal("the certificate is valid for an unknown host")
+	}
+}
+
+func TestSelfSignedCertRoundTrip(t *testing.T) {
+	tempCacheDir(t)
+
+	certFile, keyFile, err := selfSignedCert("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the client trusts only the generated certificate
+	pem, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		t.Fatal("can't read the certificate")
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want %q", body, "ok")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is the time to wait after the last change before rebuilding,
+// as editors usually produce several events for a single save.
+const watchDelay = 100 * time.Millisecond
+
+// matchPatterns checks if the file matches one of the input patterns.
+func matchPatterns(file string) bool {
+	file = filepath.ToSlash(file)
+	for _, pattern := range inpatterns {
+		if ok, _ := doublestar.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addWatchDirs adds root and all its sub-folders to the watcher
+// except the output folder and (if skipdot) the dot folders.
+func addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		path = filepath.Clean(path)
+		if path != "." && (path == outdir || strings.HasPrefix(path, outstart) || (skipdot && pathHasDot(path))) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// watchFiles watches the current folder and rebuilds the files matching the input patterns when they change.
+// The outputs of the deleted sources are removed.
+func watchFiles() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fail(err, "Problem starting the file watcher.")
+	}
+	defer watcher.Close()
+	if err := addWatchDirs(watcher, "."); err != nil {
+		return fail(err, "Problem watching the current folder.")
+	}
+	info("Watching for changes (Ctrl+C to stop).\n")
+
+	// the changed files waiting for the end of the watchDelay
+	pending := make(map[string]bool)
+	var rebuild <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			name := filepath.Clean(event.Name)
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+					try(addWatchDirs(watcher, name), "Problem watching the folder", name)
+					continue
+				}
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			pending[name] = true
+			rebuild = time.After(watchDelay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			try(err, "Problem watching the files.")
+		case <-rebuild:
+			if navigation {
+				updateSiteNav(pending)
+			}
+			for name := range pending {
+				updateFile(name)
+			}
+			try(cache.save(), "Problem saving the build cache.")
+			try(sitemap.save(), "Problem saving the sitemap.")
+			clear(pending)
+			rebuild = nil
+		}
+	}
+}
+
+// updateSiteNav rebuilds the site navigation.
+// As it is part of every page, if it changes all the pages are added to pending.
+func updateSiteNav(pending map[string]bool) {
+	s, err := findSiteNav(".", inpatterns)
+	if err != nil {
+		try(err, "Problem building the site navigation.")
+		return
+	}
+	if s.fingerprint() == site.fingerprint() {
+		return
+	}
+	info("  The site navigation changed, all pages are rebuilt.\n")
+	site = s
+	// the cache fingerprint includes the site navigation
+	cache = loadCache()
+	for _, p := range site.pages {
+		pending[filepath.FromSlash(p.file)] = true
+	}
+}
+
+// updateFile rebuilds the changed file or removes the output of the deleted one.
+func updateFile(infile string) {
+	if !matchPatterns(infile) {
+		return
+	}
+	fi, err := os.Stat(infile)
+	if err == nil {
+		if fi.Mode().IsRegular() {
+			try(buildFile(infile), "Problem building", infile)
+		}
+		return
+	}
+	if !os.IsNotExist(err) {
+		try(err, "Problem accessing", infile)
+		return
+	}
+	// the source was deleted (or renamed)
+	var outfile string
+	if strings.HasSuffix(infile, ".md") {
+		outfile = outputName(infile)
+		cache.remove(infile)
+		sitemap.remove(infile)
+	} else if movefiles {
+		outfile = filepath.Join(outdir, infile)
+	} else {
+		return
+	}
+	if err := os.Remove(outfile); err == nil {
+		info("  Removed %s.\n", outfile)
+	} else if !os.IsNotExist(err) {
+		try(err, "Problem removing", outfile)
+	}
+}
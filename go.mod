@@ -5,14 +5,20 @@ go 1.22
 toolchain go1.24.1
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/alecthomas/chroma/v2 v2.17.2
 	github.com/bmatcuk/doublestar/v4 v4.8.1
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/grokify/html-strip-tags-go v0.1.0
 	github.com/rwtodd/Go.Sed v0.0.0-20250326002959-ba712dc84b62
 	github.com/spf13/pflag v1.0.6
 	github.com/yuin/goldmark v1.7.11
 	github.com/yuin/goldmark-emoji v1.0.6
 	github.com/yuin/goldmark-highlighting/v2 v2.0.0-20230729083705-37449abec8cc
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/dlclark/regexp2 v1.11.5 // indirect
+require (
+	github.com/dlclark/regexp2 v1.11.5 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+)
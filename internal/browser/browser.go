@@ -0,0 +1,27 @@
+package browser
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// OpenWith opens the url with the command.
+// The url replaces the `%s` in the command, or is added as last argument.
+func OpenWith(command, url string) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("empty browser command")
+	}
+	found := false
+	for i, arg := range args {
+		if strings.Contains(arg, "%s") {
+			args[i] = strings.ReplaceAll(arg, "%s", url)
+			found = true
+		}
+	}
+	if !found {
+		args = append(args, url)
+	}
+	return exec.Command(args[0], args[1:]...).Start()
+}
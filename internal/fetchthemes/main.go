@@ -0,0 +1,90 @@
+// fetchthemes downloads the markdown-css themes in the `themes` folder,
+// to be embedded in the gm binary. It is used by `go generate` from the repository root.
+// With `-check` nothing is downloaded: it fails if some theme is missing (used before a release).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// themesURL is where the markdown-css themes are hosted
+const themesURL = "https://kpym.github.io/markdown-css/"
+
+// themes is the list of all available markdown-css themes
+var themes = []string{
+	"air",
+	"github",
+	"jasonm23-dark",
+	"jasonm23-foghorn",
+	"jasonm23-markdown",
+	"jasonm23-swiss",
+	"markedapp-byword",
+	"mixu-page",
+	"mixu-radar",
+	"modest",
+	"retro",
+	"roryg-ghostwriter",
+	"splendor",
+	"thomasf-solarizedcssdark",
+	"thomasf-solarizedcsslight",
+	"witex",
+}
+
+// fetch downloads the url to the file.
+func fetch(url, file string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644)
+}
+
+// check returns an error if the theme file is missing or empty.
+func check(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%s is empty", file)
+	}
+	return nil
+}
+
+func main() {
+	checkOnly := flag.Bool("check", false, "only check that all the themes are present")
+	flag.Parse()
+	failed := false
+	for _, theme := range themes {
+		name := theme + ".min.css"
+		if *checkOnly {
+			if err := check(filepath.Join("themes", name)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: the theme %s is not embedded (run `go generate`): %s\n", name, err)
+				failed = true
+			}
+			continue
+		}
+		if err := fetch(themesURL+name, filepath.Join("themes", name)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: can't download %s: %s\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Downloaded %s.\n", name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,199 @@
+// reload.js: updates the page served by gm when one of its sources changes.
+// The changes are pushed by the server as Server-Sent Events.
+// When the .md file changes, only the modified blocks of the article are replaced,
+// so the scroll position is kept, and the first modified block is scrolled into view.
+// For any other change (stylesheet, image, template) the page is reloaded.
+// With --sourcepos the editors can scroll the page to a source line,
+// and alt+click sends the clicked source line to the editors.
+(function () {
+    // morph replaces the children of live that differ between the old and the new versions.
+    // The comparison is made on the old version as sent by the server, as the live one
+    // can be modified by scripts (like the math rendering).
+    // It returns the inserted nodes (or the node after the removed ones).
+    function morph(live, oldParent, newParent) {
+        var lives = Array.prototype.slice.call(live.childNodes);
+        var olds = Array.prototype.slice.call(oldParent.childNodes);
+        var news = Array.prototype.slice.call(newParent.childNodes);
+        if (lives.length !== olds.length) {
+            // the live version doesn't match the old one, so everything is replaced
+            olds = [];
+        }
+        // the source positions are ignored, as they change for all the blocks after an added line
+        var same = function (a, b) { return withoutSourcepos(a).isEqualNode(withoutSourcepos(b)); };
+        // the unchanged nodes at the beginning and at the end
+        var start = 0;
+        while (start < olds.length && start < news.length && same(olds[start], news[start])) {
+            start++;
+        }
+        var end = 0;
+        while (end < olds.length - start && end < news.length - start &&
+            same(olds[olds.length - 1 - end], news[news.length - 1 - end])) {
+            end++;
+        }
+        if (start === olds.length && start === news.length) {
+            return [];
+        }
+        // update the source positions of the unchanged nodes at the end
+        for (var k = 1; k <= end; k++) {
+            copySourcepos(lives[lives.length - k], news[news.length - k]);
+        }
+        // replace the changed nodes in the middle
+        var next = end > 0 ? lives[lives.length - end] : null;
+        for (var i = start; i < lives.length - end; i++) {
+            live.removeChild(lives[i]);
+        }
+        var inserted = [];
+        for (var j = start; j < news.length - end; j++) {
+            var node = document.importNode(news[j], true);
+            live.insertBefore(node, next);
+            inserted.push(node);
+        }
+        if (inserted.length === 0) {
+            inserted.push(next || live);
+        }
+        return inserted;
+    }
+
+    // withoutSourcepos returns the node without the data-sourcepos attributes
+    function withoutSourcepos(node) {
+        if (node.nodeType !== Node.ELEMENT_NODE) {
+            return node;
+        }
+        var clone = node.cloneNode(true);
+        clone.removeAttribute("data-sourcepos");
+        clone.querySelectorAll("[data-sourcepos]").forEach(function (e) { e.removeAttribute("data-sourcepos"); });
+        return clone;
+    }
+
+    // copySourcepos copies the data-sourcepos attributes of the (same) node from to the node to
+    function copySourcepos(to, from) {
+        if (to.nodeType !== Node.ELEMENT_NODE) {
+            return;
+        }
+        var tos = [to].concat(Array.prototype.slice.call(to.querySelectorAll("[data-sourcepos]")));
+        var froms = [from].concat(Array.prototype.slice.call(from.querySelectorAll("[data-sourcepos]")));
+        for (var i = 0; i < tos.length && i < froms.length; i++) {
+            if (froms[i].hasAttribute("data-sourcepos")) {
+                tos[i].setAttribute("data-sourcepos", froms[i].getAttribute("data-sourcepos"));
+            }
+        }
+    }
+
+    // sourceLines returns the first and the last source lines of the element (with data-sourcepos)
+    function sourceLines(element) {
+        var m = /^(\d+):\d+-(\d+):\d+$/.exec(element.getAttribute("data-sourcepos"));
+        return m ? [parseInt(m[1], 10), parseInt(m[2], 10)] : null;
+    }
+
+    // scrollToLine scrolls to the innermost block containing the source line
+    // (or the last block before it)
+    function scrollToLine(line) {
+        var target = null;
+        document.querySelectorAll("article.markdown-body [data-sourcepos]").forEach(function (e) {
+            var lines = sourceLines(e);
+            if (lines && lines[0] <= line) {
+                target = e;
+            }
+        });
+        if (target) {
+            target.scrollIntoView({ block: "center" });
+        }
+    }
+
+    // firstElement returns the node or its next element sibling
+    function firstElement(node) {
+        while (node && node.nodeType !== Node.ELEMENT_NODE) {
+            node = node.nextSibling;
+        }
+        return node;
+    }
+
+    // sameHead checks if the heads are the same except for the title
+    function sameHead(oldHead, newHead) {
+        var strip = function (head) {
+            var clone = head.cloneNode(true);
+            clone.querySelectorAll("title").forEach(function (e) { e.remove(); });
+            return clone;
+        };
+        return strip(oldHead).isEqualNode(strip(newHead));
+    }
+
+    // update fetches the new version of the page and morphs the article and the navigation
+    function update() {
+        fetch(location.href, { cache: "no-store" }).then(function (response) {
+            if (!response.ok) {
+                throw new Error(response.statusText);
+            }
+            return response.text();
+        }).then(function (html) {
+            var page = new DOMParser().parseFromString(html, "text/html");
+            var article = document.querySelector("article.markdown-body");
+            var newArticle = page.querySelector("article.markdown-body");
+            if (!article || !previous || !newArticle || !sameHead(previousHead, page.head)) {
+                location.reload();
+                return;
+            }
+            document.title = page.title;
+            var inserted = morph(article, previous, newArticle);
+            previous = newArticle;
+            previousHead = page.head;
+            // the site navigation (outside the article)
+            ["nav.site-nav", "nav.site-pager"].forEach(function (selector) {
+                var oldNav = document.querySelector(selector);
+                var newNav = page.querySelector(selector);
+                if (oldNav && newNav && !oldNav.isEqualNode(newNav)) {
+                    oldNav.replaceWith(document.importNode(newNav, true));
+                }
+            });
+            if (inserted.length === 0) {
+                return;
+            }
+            if (window.renderMathInElement) {
+                inserted.forEach(function (node) {
+                    if (node.nodeType === Node.ELEMENT_NODE) {
+                        window.renderMathInElement(node);
+                    }
+                });
+            }
+            var changed = firstElement(inserted[0]) || article;
+            var box = changed.getBoundingClientRect();
+            if (box.bottom < 0 || box.top > window.innerHeight) {
+                changed.scrollIntoView({ block: "center" });
+            }
+        }).catch(function () {
+            location.reload();
+        });
+    }
+
+    // the head and the article as sent by the server (this script runs before the deferred ones)
+    var article = document.querySelector("article.markdown-body");
+    var previous = article ? article.cloneNode(true) : null;
+    var previousHead = document.head.cloneNode(true);
+
+    // alt+click sends the clicked source line to the editors
+    document.addEventListener("click", function (event) {
+        if (!event.altKey || !event.target.closest) {
+            return;
+        }
+        var element = event.target.closest("article.markdown-body [data-sourcepos]");
+        var lines = element && sourceLines(element);
+        if (!lines) {
+            return;
+        }
+        event.preventDefault();
+        var body = new URLSearchParams({ page: location.pathname, line: lines[0] });
+        fetch("/__gm/cursor", { method: "POST", body: body });
+    });
+
+    var events = new EventSource("/__gm/events?page=" + encodeURIComponent(location.pathname));
+    events.addEventListener("reload", function (event) {
+        if (/\.md$/i.test(event.data)) {
+            update();
+        } else {
+            location.reload();
+        }
+    });
+    events.addEventListener("scroll", function (event) {
+        scrollToLine(parseInt(event.data, 10));
+    });
+})();
@@ -0,0 +1,225 @@
+package render
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// abbrKey is used to store the abbreviation definitions in the parser context
+var abbrKey = parser.NewContextKey()
+
+// kindAbbr and kindAbbrDefinition are the kinds of the abbreviation nodes
+var (
+	kindAbbr           = ast.NewNodeKind("Abbr")
+	kindAbbrDefinition = ast.NewNodeKind("AbbrDefinition")
+)
+
+// regexAbbrDefinition matches the abbreviation definitions like `*[HTML]: Hyper Text Markup Language`
+var regexAbbrDefinition = regexp.MustCompile(`^\*\[([^\]]+)\]:[ \t]*(.*?)\s*$`)
+
+// abbrNode is an abbreviation found in the text.
+type abbrNode struct {
+	ast.BaseInline
+	Title string
+}
+
+// Kind implements ast.Node.Kind.
+func (n *abbrNode) Kind() ast.NodeKind {
+	return kindAbbr
+}
+
+// Dump implements ast.Node.Dump.
+func (n *abbrNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Title": n.Title}, nil)
+}
+
+// abbrDefinition is an abbreviation definition line (removed from the document).
+type abbrDefinition struct {
+	ast.BaseBlock
+	Term  string
+	Title string
+}
+
+// Kind implements ast.Node.Kind.
+func (n *abbrDefinition) Kind() ast.NodeKind {
+	return kindAbbrDefinition
+}
+
+// Dump implements ast.Node.Dump.
+func (n *abbrDefinition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Term": n.Term, "Title": n.Title}, nil)
+}
+
+// abbrParser parses the abbreviation definition lines.
+type abbrParser struct{}
+
+// Trigger implements parser.BlockParser.Trigger.
+func (p *abbrParser) Trigger() []byte {
+	return []byte{'*'}
+}
+
+// Open implements parser.BlockParser.Open.
+func (p *abbrParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 {
+		return nil, parser.NoChildren
+	}
+	m := regexAbbrDefinition.FindSubmatch(line[pos:])
+	if m == nil || len(strings.TrimSpace(string(m[1]))) == 0 {
+		return nil, parser.NoChildren
+	}
+	node := &abbrDefinition{Term: strings.TrimSpace(string(m[1])), Title: string(m[2])}
+	definitions, _ := pc.Get(abbrKey).([]*abbrDefinition)
+	pc.Set(abbrKey, append(definitions, node))
+	reader.Advance(advanceLength(line, segment))
+	return node, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser.Continue.
+func (p *abbrParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	return parser.Close
+}
+
+// Close implements parser.BlockParser.Close.
+func (p *abbrParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser.CanInterruptParagraph.
+func (p *abbrParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.CanAcceptIndentedLine.
+func (p *abbrParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// abbrTransformer removes the definitions and wraps all the defined terms of the document in abbreviation nodes.
+type abbrTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *abbrTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	definitions, _ := pc.Get(abbrKey).([]*abbrDefinition)
+	if len(definitions) == 0 {
+		return
+	}
+	// the last definition of a term wins
+	titles := make(map[string]string)
+	for _, d := range definitions {
+		titles[d.Term] = d.Title
+		d.Parent().RemoveChild(d.Parent(), d)
+	}
+	// the longest terms are searched first
+	terms := make([]string, 0, len(titles))
+	for term := range titles {
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	regexTerms := regexp.MustCompile(strings.Join(terms, "|"))
+
+	// collect the text nodes first, as the tree is modified after
+	source := reader.Source()
+	var texts []*ast.Text
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeSpan, *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock, *ast.RawHTML, *ast.AutoLink:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			texts = append(texts, n)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range texts {
+		splitAbbr(n, source, regexTerms, titles)
+	}
+}
+
+// isWordRune checks if the rune starting at b[i] (or ending at b[i-1] if backward) is a letter or a digit.
+func isWordRune(b []byte, i int, backward bool) bool {
+	var r rune
+	if backward {
+		if i <= 0 {
+			return false
+		}
+		r, _ = utf8.DecodeLastRune(b[:i])
+	} else {
+		if i >= len(b) {
+			return false
+		}
+		r, _ = utf8.DecodeRune(b[i:])
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// splitAbbr replaces the text node n by a sequence of text and abbreviation nodes.
+func splitAbbr(n *ast.Text, source []byte, regexTerms *regexp.Regexp, titles map[string]string) {
+	value := n.Segment.Value(source)
+	parent := n.Parent()
+	start := 0
+	for _, m := range regexTerms.FindAllIndex(value, -1) {
+		// only whole words are abbreviations
+		if isWordRune(value, m[0], true) || isWordRune(value, m[1], false) {
+			continue
+		}
+		if m[0] > start {
+			parent.InsertBefore(parent, n, ast.NewTextSegment(text.NewSegment(n.Segment.Start+start, n.Segment.Start+m[0])))
+		}
+		abbr := &abbrNode{Title: titles[string(value[m[0]:m[1]])]}
+		abbr.AppendChild(abbr, ast.NewTextSegment(text.NewSegment(n.Segment.Start+m[0], n.Segment.Start+m[1])))
+		parent.InsertBefore(parent, n, abbr)
+		start = m[1]
+	}
+	if start == 0 {
+		return
+	}
+	// the original node keeps the rest of the text (and the line breaks)
+	n.Segment = n.Segment.WithStart(n.Segment.Start + start)
+	if n.Segment.Len() == 0 && !n.SoftLineBreak() && !n.HardLineBreak() {
+		parent.RemoveChild(parent, n)
+	}
+}
+
+// abbrRenderer renders the abbreviations.
+type abbrRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *abbrRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAbbr, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString(`<abbr title="`)
+			_, _ = w.Write(util.EscapeHTML([]byte(n.(*abbrNode).Title)))
+			_, _ = w.WriteString(`">`)
+		} else {
+			_, _ = w.WriteString("</abbr>")
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(kindAbbrDefinition, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// abbrExtension enables the abbreviations defined by `*[TERM]: title` lines.
+type abbrExtension struct{}
+
+// Extend implements goldmark.Extender.
+func (e *abbrExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&abbrParser{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(&abbrTransformer{}, 500)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&abbrRenderer{}, 500)))
+}
@@ -0,0 +1,244 @@
+package render
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// inlineFootnoteStackKey holds the inline footnotes waiting for their closing bracket,
+// and inlineFootnoteListKey all the inline footnotes of the document.
+var (
+	inlineFootnoteStackKey = parser.NewContextKey()
+	inlineFootnoteListKey  = parser.NewContextKey()
+)
+
+// kindInlineFootnoteMarker is the kind of the inline footnote delimiters
+var kindInlineFootnoteMarker = ast.NewNodeKind("InlineFootnoteMarker")
+
+// inlineFootnoteMarker is the opening `^[` or the closing `]` of an inline footnote.
+// The content of the footnote is parsed as usual between the two markers,
+// and moved to a footnote by the inlineFootnoteTransformer.
+type inlineFootnoteMarker struct {
+	ast.BaseInline
+	Segment text.Segment
+	// close is the position of the closing bracket (for the opening marker)
+	close int
+	// end is the closing marker (for the opening marker)
+	end *inlineFootnoteMarker
+}
+
+// Kind implements ast.Node.Kind.
+func (n *inlineFootnoteMarker) Kind() ast.NodeKind {
+	return kindInlineFootnoteMarker
+}
+
+// Dump implements ast.Node.Dump.
+func (n *inlineFootnoteMarker) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// inlineFootnoteParser parses the inline footnotes like `^[the note]`.
+type inlineFootnoteParser struct{}
+
+// Trigger implements parser.InlineParser.Trigger.
+func (p *inlineFootnoteParser) Trigger() []byte {
+	return []byte{'^', ']'}
+}
+
+// Parse implements parser.InlineParser.Parse.
+func (p *inlineFootnoteParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	stack, _ := pc.Get(inlineFootnoteStackKey).([]*inlineFootnoteMarker)
+	if line[0] == ']' {
+		// is it the closing bracket of the last opened inline footnote?
+		if len(stack) == 0 || stack[len(stack)-1].close != segment.Start {
+			return nil
+		}
+		start := stack[len(stack)-1]
+		pc.Set(inlineFootnoteStackKey, stack[:len(stack)-1])
+		parser.ProcessDelimiters(start, pc)
+		start.end = &inlineFootnoteMarker{Segment: segment.WithStop(segment.Start + 1)}
+		block.Advance(1)
+		return start.end
+	}
+	if len(line) < 3 || line[1] != '[' {
+		return nil
+	}
+	closure := util.FindClosure(line[2:], '[', ']', true, true)
+	if closure < 1 {
+		return nil
+	}
+	start := &inlineFootnoteMarker{Segment: segment.WithStop(segment.Start + 2), close: segment.Start + 2 + closure}
+	pc.Set(inlineFootnoteStackKey, append(stack, start))
+	list, _ := pc.Get(inlineFootnoteListKey).([]*inlineFootnoteMarker)
+	pc.Set(inlineFootnoteListKey, append(list, start))
+	block.Advance(2)
+	return start
+}
+
+// inlineFootnoteTransformer converts the inline footnotes to usual footnotes.
+// It runs after the goldmark footnote transformer, so all the footnotes are renumbered in the document order.
+type inlineFootnoteTransformer struct{}
+
+// Transform implements parser.ASTTransformer.
+func (t *inlineFootnoteTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	starts, _ := pc.Get(inlineFootnoteListKey).([]*inlineFootnoteMarker)
+	pc.Set(inlineFootnoteListKey, nil)
+	pc.Set(inlineFootnoteStackKey, nil)
+
+	// replace the content between the markers by a footnote link
+	inlines := make(map[*extast.FootnoteLink]*extast.Footnote)
+	for _, start := range starts {
+		parent := start.Parent()
+		if start.end == nil || parent == nil {
+			// not closed: the marker is rendered as text
+			continue
+		}
+		footnote := extast.NewFootnote(nil)
+		paragraph := ast.NewParagraph()
+		footnote.AppendChild(footnote, paragraph)
+		for c := start.NextSibling(); c != nil && c != start.end; {
+			next := c.NextSibling()
+			paragraph.AppendChild(paragraph, c)
+			c = next
+		}
+		link := extast.NewFootnoteLink(-1)
+		link.RefCount = 1
+		parent.RemoveChild(parent, start.end)
+		parent.ReplaceChild(parent, start, link)
+		inlines[link] = footnote
+	}
+	if len(inlines) == 0 {
+		return
+	}
+
+	// number all the footnotes in the document order
+	var list *extast.FootnoteList
+	if last, ok := doc.LastChild().(*extast.FootnoteList); ok {
+		list = last
+	}
+	renumber := make(map[int]int)
+	var notes []*extast.Footnote
+	var number func(n ast.Node)
+	number = func(n ast.Node) {
+		ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			link, ok := n.(*extast.FootnoteLink)
+			if !entering || !ok {
+				return ast.WalkContinue, nil
+			}
+			if footnote, ok := inlines[link]; ok {
+				link.Index = len(renumber) + len(notes) + 1
+				footnote.Index = link.Index
+				notes = append(notes, footnote)
+				// the inline footnote can contain other footnotes
+				number(footnote)
+			} else if index, ok := renumber[link.Index]; ok {
+				link.Index = index
+			} else {
+				index = len(renumber) + len(notes) + 1
+				renumber[link.Index] = index
+				link.Index = index
+			}
+			return ast.WalkContinue, nil
+		})
+	}
+	number(doc)
+
+	if list == nil {
+		list = extast.NewFootnoteList()
+		doc.AppendChild(doc, list)
+	}
+	for c := list.FirstChild(); c != nil; c = c.NextSibling() {
+		footnote := c.(*extast.Footnote)
+		footnote.Index = renumber[footnote.Index]
+		ast.Walk(footnote, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if backlink, ok := n.(*extast.FootnoteBacklink); ok && entering {
+				backlink.Index = footnote.Index
+			}
+			return ast.WalkContinue, nil
+		})
+	}
+	for _, footnote := range notes {
+		backlink := extast.NewFootnoteBacklink(footnote.Index)
+		backlink.RefCount = 1
+		footnote.LastChild().AppendChild(footnote.LastChild(), backlink)
+		list.AppendChild(list, footnote)
+	}
+	list.SortChildren(func(n1, n2 ast.Node) int {
+		return n1.(*extast.Footnote).Index - n2.(*extast.Footnote).Index
+	})
+	list.Count = len(renumber) + len(notes)
+}
+
+// footnoteRenderer renders the inline footnote markers (if not closed)
+// and the footnote list with a configurable class and title.
+type footnoteRenderer struct {
+	html.Config
+	class string
+	title string
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *footnoteRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindInlineFootnoteMarker, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			segment := n.(*inlineFootnoteMarker).Segment
+			_, _ = w.Write(util.EscapeHTML(segment.Value(source)))
+		}
+		return ast.WalkContinue, nil
+	})
+	reg.Register(extast.KindFootnoteList, r.renderFootnoteList)
+}
+
+func (r *footnoteRenderer) renderFootnoteList(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		_, _ = w.WriteString("</ol>\n</div>\n")
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<div class="`)
+	_, _ = w.Write(util.EscapeHTML([]byte(r.class)))
+	_, _ = w.WriteString(`" role="doc-endnotes"`)
+	if node.Attributes() != nil {
+		html.RenderAttributes(w, node, html.GlobalAttributeFilter)
+	}
+	_ = w.WriteByte('>')
+	if r.XHTML {
+		_, _ = w.WriteString("\n<hr />\n")
+	} else {
+		_, _ = w.WriteString("\n<hr>\n")
+	}
+	if r.title != "" {
+		_, _ = w.WriteString(`<p class="footnotes-title">`)
+		_, _ = w.Write(util.EscapeHTML([]byte(r.title)))
+		_, _ = w.WriteString("</p>\n")
+	}
+	_, _ = w.WriteString("<ol>\n")
+	return ast.WalkContinue, nil
+}
+
+// footnoteExtension adds the inline footnotes and the footnote list options
+// to the goldmark footnote extension.
+type footnoteExtension struct {
+	class string
+	title string
+}
+
+// Extend implements goldmark.Extender.
+func (e *footnoteExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&inlineFootnoteParser{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(&inlineFootnoteTransformer{}, 1000)),
+	)
+	// the priority is higher than the goldmark footnote renderer one, to replace the footnote list rendering
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&footnoteRenderer{
+		Config: html.NewConfig(),
+		class:  e.class,
+		title:  e.title,
+	}, 400)))
+}
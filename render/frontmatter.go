@@ -0,0 +1,141 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// SplitFrontMatter separates the (optional) front matter from the markdown body.
+// The front matter is YAML if delimited by `---` lines and TOML if delimited by `+++` lines.
+// If no front matter is present, the returned meta is empty and the body is the full markdown.
+func SplitFrontMatter(markdown []byte) (meta map[string]any, body []byte, err error) {
+	meta = make(map[string]any)
+	// skip the (optional) BOM
+	src := bytes.TrimPrefix(markdown, []byte("\xef\xbb\xbf"))
+
+	// the first line decides the front matter type
+	first, rest, found := bytes.Cut(src, []byte("\n"))
+	if !found {
+		return meta, markdown, nil
+	}
+	delimiter := string(bytes.TrimRight(first, " \t\r"))
+	if delimiter != "---" && delimiter != "+++" {
+		return meta, markdown, nil
+	}
+
+	// look for the closing delimiter
+	var header []byte
+	closed := false
+	for pos := 0; pos < len(rest); {
+		end := bytes.IndexByte(rest[pos:], '\n')
+		line := rest[pos:]
+		next := len(rest)
+		if end >= 0 {
+			line = rest[pos : pos+end]
+			next = pos + end + 1
+		}
+		closing := string(bytes.TrimRight(line, " \t\r"))
+		if closing == delimiter || (delimiter == "---" && closing == "...") {
+			header = rest[:pos]
+			body = rest[next:]
+			closed = true
+			break
+		}
+		pos = next
+	}
+	if !closed {
+		// no closing delimiter: this is not a front matter
+		return meta, markdown, nil
+	}
+
+	if delimiter == "---" && !isYAMLFrontMatter(header) {
+		// a markdown starting with a thematic break is not a front matter
+		return meta, markdown, nil
+	}
+	if delimiter == "---" {
+		err = yaml.Unmarshal(header, &meta)
+	} else {
+		err = toml.Unmarshal(header, &meta)
+	}
+	if err != nil {
+		return nil, markdown, err
+	}
+	if meta == nil {
+		// an empty yaml document set the map to nil
+		meta = make(map[string]any)
+	}
+
+	return meta, body, nil
+}
+
+// isYAMLFrontMatter reports if the header between the `---` lines is a yaml front matter:
+// empty, or a yaml mapping starting on the first line (a blank line after `---` is not allowed, like in pandoc).
+func isYAMLFrontMatter(header []byte) bool {
+	if len(header) == 0 {
+		return true
+	}
+	first, _, _ := bytes.Cut(header, []byte("\n"))
+	if len(bytes.TrimSpace(first)) == 0 {
+		return false
+	}
+	var value any
+	if yaml.Unmarshal(header, &value) != nil {
+		return false
+	}
+	_, ok := value.(map[string]any)
+	return ok
+}
+
+// MetaString returns the value of key in meta if it is a scalar.
+func MetaString(meta map[string]any, key string) (string, bool) {
+	v, ok := meta[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	switch v.(type) {
+	case []any, map[string]any:
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// MetaStrings returns the value of key in meta as a list of strings.
+// A scalar value is considered as a list with one element.
+func MetaStrings(meta map[string]any, key string) ([]string, bool) {
+	if s, ok := MetaString(meta, key); ok {
+		return []string{s}, true
+	}
+	list, ok := meta[key].([]any)
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		result = append(result, fmt.Sprint(v))
+	}
+	return result, true
+}
+
+// dateLayouts are the accepted formats of the front matter dates
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// MetaDate returns the value of key in meta as a date.
+func MetaDate(meta map[string]any, key string) (time.Time, bool) {
+	if t, ok := meta[key].(time.Time); ok {
+		return t, true
+	}
+	s, ok := MetaString(meta, key)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
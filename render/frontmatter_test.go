@@ -0,0 +1,128 @@
+package render
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		meta     map[string]any
+		body     string
+		err      bool
+	}{
+		{
+			name:     "no front matter",
+			markdown: "# Title\n\ntext\n",
+			meta:     map[string]any{},
+			body:     "# Title\n\ntext\n",
+		},
+		{
+			name:     "yaml",
+			markdown: "---\ntitle: Hello\ntags: [a, b]\n---\n# Title\n",
+			meta:     map[string]any{"title": "Hello", "tags": []any{"a", "b"}},
+			body:     "# Title\n",
+		},
+		{
+			name:     "yaml closed by dots",
+			markdown: "---\ntitle: Hello\n...\ntext\n",
+			meta:     map[string]any{"title": "Hello"},
+			body:     "text\n",
+		},
+		{
+			name:     "yaml with crlf and bom",
+			markdown: "\xef\xbb\xbf---\r\ntitle: Hello\r\n---\r\ntext\r\n",
+			meta:     map[string]any{"title": "Hello"},
+			body:     "text\r\n",
+		},
+		{
+			name:     "empty yaml",
+			markdown: "---\n---\ntext\n",
+			meta:     map[string]any{},
+			body:     "text\n",
+		},
+		{
+			name:     "toml",
+			markdown: "+++\ntitle = \"Hello\"\ndraft = true\n+++\ntext\n",
+			meta:     map[string]any{"title": "Hello", "draft": true},
+			body:     "text\n",
+		},
+		{
+			name:     "invalid toml",
+			markdown: "+++\ntitle = \n+++\ntext\n",
+			err:      true,
+		},
+		{
+			name:     "not closed",
+			markdown: "---\ntitle: Hello\n\ntext\n",
+			meta:     map[string]any{},
+			body:     "---\ntitle: Hello\n\ntext\n",
+		},
+		{
+			name:     "thematic break with heading and list",
+			markdown: "---\n# Intro\n\n* item\n---\n",
+			meta:     map[string]any{},
+			body:     "---\n# Intro\n\n* item\n---\n",
+		},
+		{
+			name:     "thematic break followed by a blank line",
+			markdown: "---\n\nSome text: x\n\n---\n",
+			meta:     map[string]any{},
+			body:     "---\n\nSome text: x\n\n---\n",
+		},
+		{
+			name:     "thematic break with a paragraph",
+			markdown: "---\nSome text\n---\n",
+			meta:     map[string]any{},
+			body:     "---\nSome text\n---\n",
+		},
+		{
+			name:     "thematic break with a comment only",
+			markdown: "---\n# Intro\n---\n",
+			meta:     map[string]any{},
+			body:     "---\n# Intro\n---\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, err := SplitFrontMatter([]byte(tt.markdown))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got meta %v", meta)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(meta, tt.meta) {
+				t.Errorf("meta = %#v, want %#v", meta, tt.meta)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestMetaStrings(t *testing.T) {
+	meta := map[string]any{"one": "a", "list": []any{"a", 1}, "map": map[string]any{}}
+	tests := []struct {
+		key  string
+		want []string
+		ok   bool
+	}{
+		{"one", []string{"a"}, true},
+		{"list", []string{"a", "1"}, true},
+		{"map", nil, false},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := MetaStrings(meta, tt.key)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MetaStrings(%q) = %v, %v; want %v, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
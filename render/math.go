@@ -0,0 +1,242 @@
+package render
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// mathKey is set in the parser context if the document contains math
+var mathKey = parser.NewContextKey()
+
+// kindMath and kindMathBlock are the kinds of the math nodes
+var (
+	kindMath      = ast.NewNodeKind("Math")
+	kindMathBlock = ast.NewNodeKind("MathBlock")
+)
+
+// mathNode is an inline formula: $...$ (or $$...$$ for display style).
+type mathNode struct {
+	ast.BaseInline
+	Display bool
+	Value   []byte
+}
+
+// Kind implements ast.Node.Kind.
+func (n *mathNode) Kind() ast.NodeKind {
+	return kindMath
+}
+
+// Dump implements ast.Node.Dump.
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Value": string(n.Value)}, nil)
+}
+
+// mathBlock is a display formula starting with a line `$$` and ending with a line finishing with $$,
+// or a single line `$$...$$`.
+type mathBlock struct {
+	ast.BaseBlock
+	closed bool
+}
+
+// Kind implements ast.Node.Kind.
+func (n *mathBlock) Kind() ast.NodeKind {
+	return kindMathBlock
+}
+
+// IsRaw implements ast.Node.IsRaw.
+func (n *mathBlock) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node.Dump.
+func (n *mathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathInlineParser parses $...$ and $$...$$ on a single line.
+// Like in pandoc, the opening $ can't be followed by a space,
+// and the closing $ can't be preceded by a space or followed by a digit.
+type mathInlineParser struct{}
+
+// Trigger implements parser.InlineParser.Trigger.
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse implements parser.InlineParser.Parse.
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delim := 1
+	if len(line) > 1 && line[1] == '$' {
+		delim = 2
+	}
+	rest := line[delim:]
+	if len(rest) == 0 || (delim == 1 && util.IsSpace(rest[0])) {
+		return nil
+	}
+	for i := 1; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\':
+			i++
+			continue
+		case rest[i] != '$':
+			continue
+		case delim == 2 && (i+1 >= len(rest) || rest[i+1] != '$'):
+			continue
+		case delim == 1 && (util.IsSpace(rest[i-1]) || (i+1 < len(rest) && rest[i+1] >= '0' && rest[i+1] <= '9')):
+			continue
+		}
+		node := &mathNode{Display: delim == 2, Value: append([]byte{}, rest[:i]...)}
+		block.Advance(delim + i + delim)
+		pc.Set(mathKey, true)
+		return node
+	}
+	return nil
+}
+
+// mathBlockParser parses the $$ blocks.
+type mathBlockParser struct{}
+
+// Trigger implements parser.BlockParser.Trigger.
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open implements parser.BlockParser.Open.
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &mathBlock{}
+	first := text.NewSegment(segment.Start+pos+2, segment.Stop)
+	content := first.TrimRightSpace(reader.Source())
+	value := content.Value(reader.Source())
+	if len(value) >= 2 && bytes.HasSuffix(value, []byte("$$")) {
+		// the formula is on a single line
+		content.Stop -= 2
+		if content.Len() > 0 {
+			node.Lines().Append(content)
+		}
+		reader.Advance(advanceLength(line, segment))
+		pc.Set(mathKey, true)
+		node.closed = true
+		return node, parser.NoChildren
+	}
+	if trimmed := content.TrimLeftSpace(reader.Source()); trimmed.Len() > 0 {
+		// a formula followed by some text (like `$$x$$ is`) is inline
+		return nil, parser.NoChildren
+	}
+	reader.Advance(advanceLength(line, segment))
+	pc.Set(mathKey, true)
+	return node, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser.Continue.
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line == nil || node.(*mathBlock).closed {
+		return parser.Close
+	}
+	content := segment.TrimRightSpace(reader.Source())
+	if bytes.HasSuffix(content.Value(reader.Source()), []byte("$$")) {
+		content.Stop -= 2
+		if trimmed := content.TrimLeftSpace(reader.Source()); trimmed.Len() > 0 {
+			node.Lines().Append(content)
+		}
+		reader.Advance(advanceLength(line, segment))
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(advanceLength(line, segment))
+	return parser.Continue | parser.NoChildren
+}
+
+// advanceLength is the length of the line without the newline (skipped by the parser).
+func advanceLength(line []byte, segment text.Segment) int {
+	if bytes.HasSuffix(line, []byte("\n")) {
+		return segment.Len() - 1
+	}
+	return segment.Len()
+}
+
+// Close implements parser.BlockParser.Close.
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser.CanInterruptParagraph.
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser.CanAcceptIndentedLine.
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathRenderer renders the formulas as html spans (or div) with \(...\) or \[...\] delimiters,
+// ready to be processed by KaTeX or MathJax.
+type mathRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, r.renderMath)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathNode)
+	if n.Display {
+		_, _ = w.WriteString(`<span class="math display">\[`)
+		_, _ = w.Write(util.EscapeHTML(n.Value))
+		_, _ = w.WriteString(`\]</span>`)
+	} else {
+		_, _ = w.WriteString(`<span class="math inline">\(`)
+		_, _ = w.Write(util.EscapeHTML(n.Value))
+		_, _ = w.WriteString(`\)</span>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString(`<div class="math display"`)
+	if node.Attributes() != nil {
+		html.RenderAttributes(w, node, nil)
+	}
+	_, _ = w.WriteString(`>\[`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		if i > 0 {
+			_ = w.WriteByte('\n')
+		}
+		segment := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(util.TrimRightSpace(segment.Value(source))))
+	}
+	_, _ = w.WriteString("\\]</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// mathExtension enables the $...$ and $$...$$ formulas.
+type mathExtension struct{}
+
+// Extend implements goldmark.Extender.
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 650)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 500)))
+}
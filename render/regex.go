@@ -1,4 +1,4 @@
-package main
+package render
 
 import (
 	"fmt"
@@ -15,12 +15,6 @@ type SubstRule struct {
 
 type SubstRuleList []SubstRule
 
-// sedEngines holds the sed engines for markdown and HTML.
-var (
-	reMdRules   SubstRuleList
-	reHtmlRules SubstRuleList
-)
-
 // NewRule creates a new Rule with the given type from a string argument.
 // The argument has format "<delim>pattern><delim>replace[<delim>[<comment>]]" where <delm> is a delimiter (e.g., /, |, #, @).
 // The delimiter can not be escaped so it has to be not present in the pattern or replace string.
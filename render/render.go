@@ -0,0 +1,468 @@
+// Package render converts markdown to html the way the gm cli does:
+// front matter, goldmark with the gm extensions, html template and regex rules.
+//
+// A Converter is built once from Options, and can be used concurrently:
+//
+//	c, err := render.New(render.DefaultOptions())
+//	...
+//	res, err := c.Convert(ctx, markdown) // the html code, the title, the toc and the front matter
+//	page, err := c.Page(res, nil)        // the full html page
+package render
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"strings"
+
+	chroma "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/grokify/html-strip-tags-go"
+	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// DefaultTemplate is the default html template
+//
+//go:embed template.html
+var DefaultTemplate string
+
+// ThemeURL is the prefix of the markdown-css theme urls
+const ThemeURL = "https://kpym.github.io/markdown-css/"
+
+// Options are the conversion options.
+// They match the gm cli flags (see DefaultOptions for the default values).
+type Options struct {
+	// goldmark options
+	Attribute        bool
+	AutoHeadingID    bool
+	DefinitionList   bool
+	Footnote         bool
+	FootnotePrefix   string
+	FootnoteBacklink string
+	FootnoteTitle    string
+	FootnoteClass    string
+	Linkify          bool
+	Strikethrough    bool
+	Table            bool
+	TaskList         bool
+	Typographer      bool
+	Emoji            bool
+	Unsafe           bool
+	HardWraps        bool
+	XHTML            bool
+	Math             bool
+	SubSup           bool
+	Mark             bool
+	Ins              bool
+	Abbr             bool
+	// the code highlighting theme (empty to disable) and the line numbers
+	Highlighting string
+	LineNumbers  bool
+	// the heading levels in the table of contents
+	TOCMin int
+	TOCMax int
+	// add data-sourcepos="line:col-line:col" attributes to the block elements
+	SourcePos bool
+
+	// page options (the front matter can override them)
+	Title   string
+	Favicon string
+	// the css urls, codes or theme names
+	CSS []string
+	// the html template code (DefaultTemplate if empty)
+	Template string
+	// use the front matter `template` key (a file name or a template code) as the page template.
+	// It is off by default: the file is read on the machine of the converter.
+	FrontMatterTemplate bool
+
+	// the regex rules applied to the markdown and to the html page
+	MarkdownRules SubstRuleList
+	HTMLRules     SubstRuleList
+}
+
+// DefaultOptions returns the options used by the gm cli without flags
+// (except FrontMatterTemplate that is off).
+func DefaultOptions() Options {
+	return Options{
+		Attribute:        true,
+		AutoHeadingID:    true,
+		DefinitionList:   true,
+		Footnote:         true,
+		FootnoteBacklink: "&#x21a9;&#xfe0e;",
+		FootnoteClass:    "footnotes",
+		Linkify:          true,
+		Strikethrough:    true,
+		Table:            true,
+		TaskList:         true,
+		Typographer:      true,
+		Emoji:            true,
+		Unsafe:           true,
+		Highlighting:     "github",
+		TOCMin:           1,
+		TOCMax:           6,
+		CSS:              []string{"github"},
+	}
+}
+
+// Converter converts markdown to html.
+// It is safe for concurrent use.
+type Converter struct {
+	options  Options
+	markdown goldmark.Markdown
+	template *template.Template
+	shell    string
+	css      []string
+}
+
+// Result is a converted markdown document.
+type Result struct {
+	// the html code of the markdown (without the template)
+	HTML string
+	// the page title: from the front matter, the Title option or the first h1
+	Title string
+	// the title found in the document: the front matter `title` or the first h1 ("" if none)
+	DocumentTitle string
+	// the table of contents
+	TOC *TOC
+	// the front matter values
+	Meta map[string]any
+	// the document contains math formulas
+	Math bool
+	// the parsed markdown document (the node segments are in Source)
+	Doc ast.Node
+	// the markdown without the front matter (after the markdown regex rules)
+	Source []byte
+	// the number of lines before Source (the front matter ones)
+	Offset int
+}
+
+// TemplateError is an error (parsing or execution) of the html template.
+// The template source is kept to show the line of the error.
+type TemplateError struct {
+	Source string
+	Err    error
+}
+
+// Error implements error.
+func (e *TemplateError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// New returns a converter with the options.
+// The error is a *TemplateError if the template can't be parsed.
+func New(options Options) (*Converter, error) {
+	c := &Converter{options: options, shell: options.Template}
+	if c.shell == "" {
+		c.shell = DefaultTemplate
+	}
+	var err error
+	c.template, err = template.New("md").Parse(c.shell)
+	if err != nil {
+		return nil, &TemplateError{Source: c.shell, Err: fmt.Errorf("problem parsing the HTML template: %w", err)}
+	}
+	c.css = make([]string, len(options.CSS))
+	for i, css := range options.CSS {
+		c.css[i] = ExpandCSS(css)
+	}
+	c.markdown = newMarkdown(options)
+	return c, nil
+}
+
+// Options returns the options of the converter.
+func (c *Converter) Options() Options {
+	return c.options
+}
+
+// newMarkdown returns the goldmark parser configured by the options.
+func newMarkdown(options Options) goldmark.Markdown {
+	var (
+		goldmarkOptions []goldmark.Option
+		rendererOptions []renderer.Option
+		extensions      []goldmark.Extender
+		parserOptions   []parser.Option
+	)
+
+	if options.AutoHeadingID {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+	if options.DefinitionList {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+	if options.Footnote {
+		extensions = append(extensions,
+			extension.NewFootnote(
+				extension.WithFootnoteIDPrefix(options.FootnotePrefix),
+				extension.WithFootnoteBacklinkHTML(options.FootnoteBacklink),
+			),
+			&footnoteExtension{class: options.FootnoteClass, title: options.FootnoteTitle},
+		)
+	}
+	if options.Linkify {
+		extensions = append(extensions, extension.Linkify)
+	}
+	if options.Strikethrough {
+		extensions = append(extensions, extension.Strikethrough)
+	}
+	if options.Table {
+		extensions = append(extensions, extension.Table)
+	}
+	if options.TaskList {
+		extensions = append(extensions, extension.TaskList)
+	}
+	if options.Typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	if options.Emoji {
+		extensions = append(extensions, emoji.Emoji)
+	}
+	if options.Math {
+		extensions = append(extensions, &mathExtension{})
+	}
+	if options.SubSup {
+		extensions = append(extensions, subTag, supTag)
+	}
+	if options.Mark {
+		extensions = append(extensions, markTag)
+	}
+	if options.Ins {
+		extensions = append(extensions, insTag)
+	}
+	if options.Abbr {
+		extensions = append(extensions, &abbrExtension{})
+	}
+	if options.Attribute {
+		parserOptions = append(parserOptions, parser.WithAttribute())
+	}
+	if options.Unsafe {
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+	if options.HardWraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+	if options.XHTML {
+		rendererOptions = append(rendererOptions, html.WithXHTML())
+	}
+
+	if options.Highlighting != "" {
+		var chromaOptions []chroma.Option
+		chromaOptions = append(chromaOptions, chroma.WithLineNumbers(options.LineNumbers))
+
+		extensions = append(extensions, highlighting.NewHighlighting(
+			highlighting.WithStyle(options.Highlighting),
+			highlighting.WithFormatOptions(chromaOptions...),
+		))
+	}
+
+	// the table of contents is always collected
+	extensions = append(extensions, &tocExtension{min: options.TOCMin, max: options.TOCMax})
+	if options.SourcePos {
+		extensions = append(extensions, &sourceposExtension{})
+	}
+
+	goldmarkOptions = append(
+		goldmarkOptions,
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+
+	return goldmark.New(goldmarkOptions...)
+}
+
+// regexTitle is used to find the first h1 title (if any)
+var regexTitle = regexp.MustCompile(`(?m)<h1[^>]*>(.*?)</h1>`)
+
+// Title search for the first h1 title in the html code.
+// If there is no one it returns the default title.
+func Title(htmlStr string) string {
+	if t := headingTitle(htmlStr); t != "" {
+		return t
+	}
+	return "GoldMark"
+}
+
+// headingTitle returns the first h1 title in the html code ("" if none).
+func headingTitle(htmlStr string) string {
+	res := regexTitle.FindStringSubmatch(htmlStr)
+	if len(res) > 1 {
+		return strip.StripTags(string(res[1]))
+	}
+	return ""
+}
+
+// documentTitle returns the front matter title or the first h1 title ("" if none).
+func documentTitle(meta map[string]any, htmlStr string) string {
+	if t, ok := MetaString(meta, "title"); ok && t != "" {
+		return t
+	}
+	return headingTitle(htmlStr)
+}
+
+// title returns the page title: from the front matter, the Title option or the first h1.
+func (c *Converter) title(meta map[string]any, htmlStr string) string {
+	if t, ok := MetaString(meta, "title"); ok && t != "" {
+		return t
+	}
+	if c.options.Title != "" {
+		return c.options.Title
+	}
+	return Title(htmlStr)
+}
+
+// Convert extracts the front matter (if any) and converts the markdown to html code.
+// The markdown regex rules are applied first.
+func (c *Converter) Convert(ctx context.Context, src []byte) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.options.MarkdownRules) > 0 {
+		src = c.options.MarkdownRules.Apply(src)
+	}
+
+	// separate the front matter from the markdown
+	meta, body, err := SplitFrontMatter(src)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing the front matter: %w", err)
+	}
+
+	// convert md to html code
+	var htmlBuf bytes.Buffer
+	pc := parser.NewContext()
+	// the source positions are counted from the beginning of the file
+	offset := bytes.Count(src[:len(src)-len(body)], []byte("\n"))
+	pc.Set(sourceposOffsetKey, offset)
+	doc := c.markdown.Parser().Parse(text.NewReader(body), parser.WithContext(pc))
+	err = c.markdown.Renderer().Render(&htmlBuf, body, doc)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing markdown code to html with goldmark: %w", err)
+	}
+
+	res := &Result{HTML: htmlBuf.String(), Meta: meta, Math: pc.Get(mathKey) != nil, Doc: doc, Source: body, Offset: offset}
+	res.TOC, _ = pc.Get(tocKey).(*TOC)
+	res.Title = c.title(meta, res.HTML)
+	res.DocumentTitle = documentTitle(meta, res.HTML)
+	return res, nil
+}
+
+// Page integrates the converted html code in the html template.
+// The front matter can override the title, the favicon, the css
+// and the template (only with the FrontMatterTemplate option).
+// The data values are added to the template data (like .nav or .liveupdate for the cli).
+// The html regex rules are not applied (see Render).
+func (c *Converter) Page(res *Result, data map[string]any) ([]byte, error) {
+	pageTemplate, pageShell := c.template, c.shell
+	pageFavicon, pageCSS := c.options.Favicon, c.css
+	if icon, ok := MetaString(res.Meta, "icon"); ok {
+		pageFavicon = icon
+	}
+	if list, ok := MetaStrings(res.Meta, "css"); ok {
+		pageCSS = make([]string, len(list))
+		for i, css := range list {
+			pageCSS[i] = ExpandCSS(css)
+		}
+	}
+	if shell, ok := MetaString(res.Meta, "template"); ok && c.options.FrontMatterTemplate {
+		pageShell = ReadTemplate(shell)
+		var err error
+		pageTemplate, err = template.New("md").Parse(pageShell)
+		if err != nil {
+			return nil, &TemplateError{Source: pageShell, Err: fmt.Errorf("problem parsing the front matter HTML template: %w", err)}
+		}
+	}
+
+	// combine the template and the resulting html
+	var pageData = make(map[string]any, len(data)+8)
+	for k, v := range data {
+		pageData[k] = v
+	}
+	pageData["title"] = template.HTML(c.title(res.Meta, res.HTML))
+	// the favicon url
+	if pageFavicon != "" {
+		pageData["favicon"] = template.HTML(pageFavicon)
+	}
+	// the css can be either an url or a code
+	type cssType struct {
+		Url  template.HTML
+		Code template.HTML
+	}
+	cssall := make([]cssType, len(pageCSS))
+	for i, c := range pageCSS {
+		if strings.HasPrefix(c, "<style>") {
+			cssall[i] = cssType{Code: template.HTML(c)}
+		} else {
+			cssall[i] = cssType{Url: template.HTML(c)}
+		}
+	}
+	pageData["css"] = cssall
+	pageData["html"] = template.HTML(res.HTML)
+	pageData["meta"] = res.Meta
+	pageData["toc"] = res.TOC
+	if res.Math {
+		pageData["math"] = true
+	}
+
+	var htmlBuf bytes.Buffer
+	err := pageTemplate.Execute(&htmlBuf, pageData)
+	if err != nil {
+		return nil, &TemplateError{Source: pageShell, Err: fmt.Errorf("problem building HTML from template: %w", err)}
+	}
+
+	return htmlBuf.Bytes(), nil
+}
+
+// Render converts the markdown to the full html page,
+// with the html regex rules applied.
+func (c *Converter) Render(ctx context.Context, src []byte, data map[string]any) ([]byte, error) {
+	res, err := c.Convert(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	page, err := c.Page(res, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.options.HTMLRules) > 0 {
+		page = c.options.HTMLRules.Apply(page)
+	}
+	return page, nil
+}
+
+// ExpandCSS converts a css parameter to an url or a <style> code.
+// If c is not empty and not containing '/' or '.' or '{' it should be a theme name.
+func ExpandCSS(c string) string {
+	if c != "" && !strings.ContainsAny(c, "/.{") {
+		return ThemeURL + c + ".min.css"
+	} else if strings.Contains(c, "{") {
+		return "<style>" + c + "</style>"
+	}
+	return c
+}
+
+// ReadTemplate returns the content of the shell file if it exists,
+// the shell string itself otherwise, or the default template if empty.
+func ReadTemplate(shell string) string {
+	t, err := os.ReadFile(shell)
+	if err == nil {
+		shell = string(t)
+	}
+	if shell == "" {
+		shell = DefaultTemplate
+	}
+	return shell
+}
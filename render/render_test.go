@@ -0,0 +1,249 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// convert converts the markdown with the default options and the math, abbr, sub-sup, mark and ins extensions.
+// The options are modified by setup (if not nil).
+func convert(t *testing.T, markdown string, setup func(o *Options)) *Result {
+	t.Helper()
+	options := DefaultOptions()
+	options.Math = true
+	options.Abbr = true
+	options.SubSup = true
+	options.Mark = true
+	options.Ins = true
+	if setup != nil {
+		setup(&options)
+	}
+	c, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Convert(context.Background(), []byte(markdown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		options  func(o *Options)
+		title    string
+		docTitle string
+		math     bool
+		contains []string
+	}{
+		{
+			name:     "title from h1",
+			markdown: "# Hello *world*\n\ntext\n",
+			title:    "Hello world",
+			docTitle: "Hello world",
+			contains: []string{`<h1 id="hello-world">Hello <em>world</em></h1>`, "<p>text</p>"},
+		},
+		{
+			name:     "title from front matter",
+			markdown: "---\ntitle: Meta\n---\n# Hello\n",
+			title:    "Meta",
+			docTitle: "Meta",
+		},
+		{
+			name:     "default title",
+			markdown: "text\n",
+			title:    "GoldMark",
+		},
+		{
+			name:     "math",
+			markdown: "$x^2$ and\n\n$$\ny\n$$\n",
+			title:    "GoldMark",
+			math:     true,
+			contains: []string{`<span class="math inline">\(x^2\)</span>`, `<div class="math display">\[y\]</div>`},
+		},
+		{
+			name:     "inline display math at the beginning of a line",
+			markdown: "$$x$$ is inline\n\nmore\n",
+			title:    "GoldMark",
+			math:     true,
+			contains: []string{`<p><span class="math display">\[x\]</span> is inline</p>`, "<p>more</p>"},
+		},
+		{
+			name:     "text after the opening $$",
+			markdown: "$$ trailing\n\nmore\n",
+			title:    "GoldMark",
+			contains: []string{"<p>$$ trailing</p>", "<p>more</p>"},
+		},
+		{
+			name:     "abbreviation",
+			markdown: "The HTML spec.\n\n*[HTML]: Hyper Text Markup Language\n",
+			title:    "GoldMark",
+			contains: []string{`<abbr title="Hyper Text Markup Language">HTML</abbr>`},
+		},
+		{
+			name:     "subscript next to strikethrough",
+			markdown: "H~2~O is ~~not~~ water\n",
+			title:    "GoldMark",
+			contains: []string{"<p>H<sub>2</sub>O is <del>not</del> water</p>"},
+		},
+		{
+			name:     "nested subscript and strikethrough",
+			markdown: "~~a ~b~ c~~ and ~a ~~b~~ c~\n",
+			title:    "GoldMark",
+			contains: []string{"<p><del>a <sub>b</sub> c</del> and <sub>a <del>b</del> c</sub></p>"},
+		},
+		{
+			name:     "superscript",
+			markdown: "2^10^ bytes\n",
+			title:    "GoldMark",
+			contains: []string{"<p>2<sup>10</sup> bytes</p>"},
+		},
+		{
+			name:     "mark and ins",
+			markdown: "==a ++b++== ++c++\n",
+			title:    "GoldMark",
+			contains: []string{"<p><mark>a <ins>b</ins></mark> <ins>c</ins></p>"},
+		},
+		{
+			name:     "footnotes numbered in the reference order",
+			markdown: "a[^z] b^[inline] c[^y]\n\n[^y]: Y\n[^z]: Z\n",
+			title:    "GoldMark",
+			contains: []string{
+				`<a href="#fn:1" class="footnote-ref" role="doc-noteref">1</a></sup> b`,
+				`<a href="#fn:3" class="footnote-ref" role="doc-noteref">3</a></sup></p>`,
+				"<li id=\"fn:1\">\n<p>Z&#160;",
+				"<li id=\"fn:2\">\n<p>inline&#160;",
+				"<li id=\"fn:3\">\n<p>Y&#160;",
+			},
+		},
+		{
+			name:     "footnote options",
+			markdown: "a[^1]\n\n[^1]: One\n",
+			options: func(o *Options) {
+				o.FootnotePrefix = "p-"
+				o.FootnoteTitle = "Notes"
+				o.FootnoteClass = "notes"
+				o.FootnoteBacklink = "back"
+			},
+			title: "GoldMark",
+			contains: []string{
+				`<sup id="p-fnref:1"><a href="#p-fn:1" class="footnote-ref" role="doc-noteref">1</a></sup>`,
+				"<div class=\"notes\" role=\"doc-endnotes\">\n<hr>\n<p class=\"footnotes-title\">Notes</p>",
+				"<li id=\"p-fn:1\">\n<p>One&#160;<a href=\"#p-fnref:1\" class=\"footnote-backref\" role=\"doc-backlink\">back</a></p>",
+			},
+		},
+		{
+			name:     "toc marker",
+			markdown: "# T\n\n[TOC]\n\n## A\n",
+			title:    "T",
+			docTitle: "T",
+			contains: []string{"<nav class=\"toc\">\n<ul>\n<li><a href=\"#t\">T</a>\n<ul>\n<li><a href=\"#a\">A</a></li>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := convert(t, tt.markdown, tt.options)
+			if res.Title != tt.title {
+				t.Errorf("title = %q, want %q", res.Title, tt.title)
+			}
+			if res.DocumentTitle != tt.docTitle {
+				t.Errorf("document title = %q, want %q", res.DocumentTitle, tt.docTitle)
+			}
+			if res.Math != tt.math {
+				t.Errorf("math = %v, want %v", res.Math, tt.math)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(res.HTML, s) {
+					t.Errorf("html does not contain %q:\n%s", s, res.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertTOC(t *testing.T) {
+	res := convert(t, "# T\n\n## A\n\n### B\n\n## C\n", nil)
+	if res.TOC == nil || len(res.TOC.Items) != 1 {
+		t.Fatalf("toc = %+v, want one top item", res.TOC)
+	}
+	top := res.TOC.Items[0]
+	if top.ID != "t" || top.Level != 1 || len(top.Items) != 2 {
+		t.Fatalf("top item = %+v", top)
+	}
+	if a, c := top.Items[0], top.Items[1]; a.ID != "a" || len(a.Items) != 1 || a.Items[0].ID != "b" || c.ID != "c" {
+		t.Errorf("sub items = %+v, %+v", a, c)
+	}
+}
+
+func TestConvertCanceled(t *testing.T) {
+	c, err := New(DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Convert(ctx, []byte("text")); err == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestPage(t *testing.T) {
+	const markdown = "---\ntitle: Meta\ncss: a.css\ntemplate: \"<b>{{.title}}</b>{{.html}}{{.extra}}\"\n---\n# Hello\n"
+	for _, frontMatterTemplate := range []bool{false, true} {
+		options := DefaultOptions()
+		options.FrontMatterTemplate = frontMatterTemplate
+		c, err := New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Convert(context.Background(), []byte(markdown))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := c.Page(res, map[string]any{"extra": "!"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var contains []string
+		if frontMatterTemplate {
+			contains = []string{"<b>Meta</b><h1 id=\"hello\">Hello</h1>\n!"}
+		} else {
+			contains = []string{"<title>Meta</title>", `href="a.css"`, `<h1 id="hello">Hello</h1>`}
+		}
+		for _, s := range contains {
+			if !strings.Contains(string(page), s) {
+				t.Errorf("FrontMatterTemplate=%v: page does not contain %q:\n%s", frontMatterTemplate, s, page)
+			}
+		}
+		if !frontMatterTemplate && strings.Contains(string(page), "<b>Meta</b>") {
+			t.Errorf("the front matter template is used without the FrontMatterTemplate option:\n%s", page)
+		}
+	}
+}
+
+func TestRenderRules(t *testing.T) {
+	options := DefaultOptions()
+	options.Template = "{{.html}}"
+	var err error
+	if options.MarkdownRules, err = DecodeRules("/foo/bar/"); err != nil {
+		t.Fatal(err)
+	}
+	if options.HTMLRules, err = DecodeRules("/<p>/<p class=x>/"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := c.Render(context.Background(), []byte("foo\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p class=x>bar</p>\n"; string(page) != want {
+		t.Errorf("page = %q, want %q", page, want)
+	}
+}
@@ -0,0 +1,328 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// sourceposOffsetKey holds the number of lines before the parsed markdown (the front matter ones)
+var sourceposOffsetKey = parser.NewContextKey()
+
+// sourceposTransformer adds `data-sourcepos="line:col-line:col"` attributes to the block elements.
+type sourceposTransformer struct{}
+
+// kindSourceposBlock is the kind of the sourcepos wrapper node
+var kindSourceposBlock = ast.NewNodeKind("SourceposBlock")
+
+// sourceposBlock wraps the code blocks, that are rendered without their attributes
+// (by goldmark and by the highlighting), in a div with the data-sourcepos attribute.
+type sourceposBlock struct {
+	ast.BaseBlock
+}
+
+// Kind implements ast.Node.Kind.
+func (n *sourceposBlock) Kind() ast.NodeKind {
+	return kindSourceposBlock
+}
+
+// Dump implements ast.Node.Dump.
+func (n *sourceposBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// sourcepos computes the source ranges of the blocks, in the document order.
+// The ranges include the block markers (like `#`, `>`, `-` or the code fences).
+// The offsets are the ones of the first and the last characters of the block.
+type sourcepos struct {
+	source []byte
+	// the beginning of the line after the last block (where the next block is searched if needed)
+	cursor int
+	// the number of lines before the source (the front matter ones)
+	offset int
+}
+
+// isSpace checks if c is a space character (the line breaks included).
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// lineStart returns the offset of the beginning of the line containing offset.
+func (p *sourcepos) lineStart(offset int) int {
+	return bytes.LastIndexByte(p.source[:offset], '\n') + 1
+}
+
+// nextLine returns the offset of the beginning of the line after the one containing offset.
+func (p *sourcepos) nextLine(offset int) int {
+	if i := bytes.IndexByte(p.source[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(p.source)
+}
+
+// line returns the line containing offset, without the line break.
+func (p *sourcepos) line(offset int) []byte {
+	start, stop := p.lineStart(offset), p.nextLine(offset)
+	return bytes.TrimRight(p.source[start:stop], "\r\n")
+}
+
+// lineEnd returns the offset of the last non space character of the line containing offset.
+func (p *sourcepos) lineEnd(offset int) int {
+	start := p.lineStart(offset)
+	end := start + len(bytes.TrimRight(p.line(offset), " \t"))
+	if end > start {
+		end--
+	}
+	return end
+}
+
+// nextBlockLine returns the beginning of the first non blank line after the cursor
+// (the lines with only `>` are blank inside the quotes).
+func (p *sourcepos) nextBlockLine() int {
+	for pos := p.cursor; pos < len(p.source); pos = p.nextLine(pos) {
+		if len(bytes.Trim(p.line(pos), " \t>")) > 0 {
+			return pos
+		}
+	}
+	return len(p.source)
+}
+
+// firstNonSpace returns the offset of the first non space character of the line at start.
+func (p *sourcepos) firstNonSpace(start int) int {
+	line := p.line(start)
+	return start + len(line) - len(bytes.TrimLeft(line, " \t"))
+}
+
+// fenceRange returns the range of a fenced block (code or math) with its content lines.
+// The fence characters are `chars` and the closing fence has at least `length` of them.
+func (p *sourcepos) fenceRange(lines *text.Segments, info *ast.Text, chars string, length int) (start, stop int) {
+	var open int
+	switch {
+	case info != nil:
+		open = p.lineStart(info.Segment.Start)
+	case lines.Len() > 0:
+		first := lines.At(0).Start
+		open = p.lineStart(first)
+		if !bytes.ContainsAny(p.source[open:first], chars) {
+			// the content starts on the line after the opening fence
+			open = p.lineStart(open - 1)
+		}
+	default:
+		open = p.nextBlockLine()
+	}
+	start = open
+	if i := bytes.IndexAny(p.line(open), chars); i >= 0 {
+		start += i
+	}
+	if start >= len(p.source) {
+		return start, start
+	}
+	fence := p.source[start]
+	isFence := func(line []byte) bool {
+		line = bytes.TrimRight(line, " \t")
+		rest := bytes.TrimRight(line, string(fence))
+		return len(line)-len(rest) >= length && len(bytes.Trim(rest, " \t>")) == 0
+	}
+	last := open
+	if lines.Len() > 0 {
+		last = p.lineStart(lines.At(lines.Len() - 1).Start)
+	}
+	switch {
+	case last != open && fence == '$' && bytes.HasSuffix(bytes.TrimRight(p.line(last), " \t"), []byte("$$")):
+		// the math block closed on its last line
+	case last == open && fence == '$' && lines.Len() > 0 && bytes.HasSuffix(bytes.TrimRight(p.line(last), " \t"), []byte("$$")):
+		// the math block on a single line
+	case p.nextLine(last) < len(p.source) && isFence(p.line(p.nextLine(last))):
+		last = p.nextLine(last)
+	}
+	return start, p.lineEnd(last)
+}
+
+// markerStart returns the beginning of the marker of a container block (like `>`, `-`, `1.` or `[^1]:`)
+// placed before its first child starting at child.
+func (p *sourcepos) markerStart(n ast.Node, child int) int {
+	ls := p.lineStart(child)
+	i := child
+	for i > ls && (p.source[i-1] == ' ' || p.source[i-1] == '\t') {
+		i--
+	}
+	if n.Kind() == ast.KindBlockquote {
+		if i > ls && p.source[i-1] == '>' {
+			return i - 1
+		}
+		return child
+	}
+	for i > ls && !isSpace(p.source[i-1]) {
+		i--
+	}
+	return i
+}
+
+// blockRange returns the source range of the block, and sets the ranges of its descendants.
+func (p *sourcepos) blockRange(n ast.Node) (start, stop int, ok bool) {
+	// the children first: they give the range of the containers
+	var cstart, cstop int
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.Type() != ast.TypeBlock {
+			continue
+		}
+		if s, e, cok := p.blockRange(c); cok {
+			if !ok || s < cstart {
+				cstart = s
+			}
+			if !ok || e > cstop {
+				cstop = e
+			}
+			ok = true
+		}
+	}
+	lines := n.Lines()
+	switch {
+	case n.Kind() == ast.KindDocument:
+		return 0, 0, false
+	case n.Kind() == ast.KindFencedCodeBlock:
+		start, stop = p.fenceRange(lines, n.(*ast.FencedCodeBlock).Info, "`~", 3)
+	case n.Kind() == kindMathBlock:
+		start, stop = p.fenceRange(lines, nil, "$", 2)
+	case ok && (n.Kind() == ast.KindList || n.Kind() == extast.KindTable || n.Kind() == extast.KindFootnoteList ||
+		n.Kind() == extast.KindDefinitionList):
+		// no marker of their own
+		start, stop = cstart, cstop
+	case ok && (n.Kind() == extast.KindTableRow || n.Kind() == extast.KindTableHeader):
+		start, stop = p.markerStart(n, cstart), p.lineEnd(cstart)
+	case ok:
+		start, stop = p.markerStart(n, cstart), cstop
+	case lines.Len() > 0:
+		start = lines.At(0).Start
+		last := lines.At(lines.Len() - 1).Start
+		stop = p.lineEnd(last)
+		if h, isHeading := n.(*ast.Heading); isHeading {
+			ls := p.lineStart(start)
+			i := start
+			for i > ls && (p.source[i-1] == ' ' || p.source[i-1] == '\t') {
+				i--
+			}
+			hashes := i
+			for hashes > ls && p.source[hashes-1] == '#' {
+				hashes--
+			}
+			if i-hashes == h.Level {
+				start = hashes
+			} else if next := p.nextLine(last); next < len(p.source) {
+				// a setext heading ends with its underline
+				stop = p.lineEnd(next)
+			}
+		}
+		if html, isHTML := n.(*ast.HTMLBlock); isHTML && html.HasClosure() {
+			stop = p.lineEnd(html.ClosureLine.Start)
+		}
+		if n.Kind() == extast.KindTableCell {
+			// a cell is a part of its line
+			stop = lines.At(lines.Len()-1).Stop - 1
+		}
+	case n.Kind() == ast.KindThematicBreak || n.Kind() == ast.KindHeading || n.Kind() == ast.KindListItem ||
+		n.Kind() == ast.KindBlockquote:
+		// the blocks without content are on the next line
+		line := p.nextBlockLine()
+		if line >= len(p.source) {
+			return 0, 0, false
+		}
+		start, stop = p.firstNonSpace(line), p.lineEnd(line)
+		if n.Kind() == ast.KindThematicBreak {
+			// the break characters are at the end of the line (after the container markers)
+			c := p.source[stop]
+			for start = stop; start > line && (p.source[start-1] == c || p.source[start-1] == ' ' || p.source[start-1] == '\t'); start-- {
+			}
+			for p.source[start] != c {
+				start++
+			}
+		}
+	default:
+		return 0, 0, false
+	}
+	if stop < start {
+		stop = start
+	}
+	if next := p.nextLine(stop); next > p.cursor {
+		p.cursor = next
+	}
+	startLine, startCol := sourcePosition(p.source, start)
+	stopLine, stopCol := sourcePosition(p.source, stop)
+	n.SetAttributeString("data-sourcepos", []byte(fmt.Sprintf("%d:%d-%d:%d", startLine+p.offset, startCol, stopLine+p.offset, stopCol)))
+	return start, stop, true
+}
+
+// sourcePosition returns the line and the column (both starting from 1) of the offset in source.
+func sourcePosition(source []byte, offset int) (line, col int) {
+	before := source[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = offset - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return line, col
+}
+
+// Transform implements parser.ASTTransformer.
+func (t *sourceposTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	offset, _ := pc.Get(sourceposOffsetKey).(int)
+	p := &sourcepos{source: reader.Source(), offset: offset}
+	p.blockRange(doc)
+
+	// move the attribute of the code blocks to a wrapper
+	var codes []ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if n.Kind() == ast.KindFencedCodeBlock || n.Kind() == ast.KindCodeBlock {
+			codes = append(codes, n)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, n := range codes {
+		pos, ok := n.AttributeString("data-sourcepos")
+		if !ok {
+			continue
+		}
+		wrapper := &sourceposBlock{}
+		wrapper.SetBlankPreviousLines(n.HasBlankPreviousLines())
+		wrapper.SetAttributeString("data-sourcepos", pos)
+		n.RemoveAttributes()
+		n.Parent().ReplaceChild(n.Parent(), n, wrapper)
+		wrapper.AppendChild(wrapper, n)
+	}
+}
+
+// sourceposRenderer renders the sourcepos wrappers.
+type sourceposRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *sourceposRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindSourceposBlock, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString("<div")
+			html.RenderAttributes(w, n, nil)
+			_, _ = w.WriteString(">\n")
+		} else {
+			_, _ = w.WriteString("</div>\n")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// sourceposExtension adds the source position attributes.
+type sourceposExtension struct{}
+
+// Extend implements goldmark.Extender.
+// The transformer runs last, when the document structure is final.
+func (e *sourceposExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&sourceposTransformer{}, 10000)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&sourceposRenderer{}, 500)))
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// sourceposList returns the "kind line:col-line:col" of the blocks of the markdown, in the document order.
+func sourceposList(t *testing.T, markdown string) []string {
+	t.Helper()
+	options := DefaultOptions()
+	options.SourcePos = true
+	options.Math = true
+	c, err := New(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Convert(context.Background(), []byte(markdown))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	_ = ast.Walk(res.Doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if pos, ok := n.AttributeString("data-sourcepos"); ok {
+			list = append(list, n.Kind().String()+" "+string(pos.([]byte)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return list
+}
+
+func TestSourcepos(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []string
+	}{
+		{
+			name:     "atx heading",
+			markdown: "# A\n\n## B ##\n",
+			want:     []string{"Heading 1:1-1:3", "Heading 3:1-3:7"},
+		},
+		{
+			name:     "setext heading",
+			markdown: "Title\n=====\n",
+			want:     []string{"Heading 1:1-2:5"},
+		},
+		{
+			name:     "paragraph",
+			markdown: "one\ntwo\n",
+			want:     []string{"Paragraph 1:1-2:3"},
+		},
+		{
+			name:     "list",
+			markdown: "* one\n* two\n  more\n",
+			want:     []string{"List 1:1-3:6", "ListItem 1:1-1:5", "TextBlock 1:3-1:5", "ListItem 2:1-3:6", "TextBlock 2:3-3:6"},
+		},
+		{
+			name:     "ordered list",
+			markdown: "10. one\n",
+			want:     []string{"List 1:1-1:7", "ListItem 1:1-1:7", "TextBlock 1:5-1:7"},
+		},
+		{
+			name:     "blockquote",
+			markdown: "> quote\n> more\n",
+			want:     []string{"Blockquote 1:1-2:6", "Paragraph 1:3-2:6"},
+		},
+		{
+			name:     "nested containers",
+			markdown: "> - a\n>   > b\n",
+			want: []string{"Blockquote 1:1-2:7", "List 1:3-2:7", "ListItem 1:3-2:7", "TextBlock 1:5-1:5",
+				"Blockquote 2:5-2:7", "Paragraph 2:7-2:7"},
+		},
+		{
+			name:     "fenced code",
+			markdown: "```go\ncode\n```\n\n~~~\n~~~\n",
+			want:     []string{"SourceposBlock 1:1-3:3", "SourceposBlock 5:1-6:3"},
+		},
+		{
+			name:     "fenced code in a list",
+			markdown: "- a\n\n  ```\n  c\n  ```\n",
+			want:     []string{"List 1:1-5:5", "ListItem 1:1-5:5", "Paragraph 1:3-1:3", "SourceposBlock 3:3-5:5"},
+		},
+		{
+			name:     "indented code",
+			markdown: "a\n\n    code\n    more\n",
+			want:     []string{"Paragraph 1:1-1:1", "SourceposBlock 3:5-4:8"},
+		},
+		{
+			name:     "thematic break",
+			markdown: "a\n\n---\n\n> * * *\n",
+			want:     []string{"Paragraph 1:1-1:1", "ThematicBreak 3:1-3:3", "Blockquote 5:1-5:7", "ThematicBreak 5:3-5:7"},
+		},
+		{
+			name:     "math block",
+			markdown: "$$\nx^2\n$$\n",
+			want:     []string{"MathBlock 1:1-3:2"},
+		},
+		{
+			name:     "table",
+			markdown: "| a | b |\n|---|---|\n| 1 | 2 |\n",
+			want: []string{"Table 1:1-3:9", "TableHeader 1:1-1:9", "TableCell 1:3-1:3", "TableCell 1:7-1:7",
+				"TableRow 3:1-3:9", "TableCell 3:3-3:3", "TableCell 3:7-3:7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sourceposList(t, tt.markdown)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceposHTML(t *testing.T) {
+	const markdown = "# A\n\n```go\nx := 1\n```\n\n    code\n"
+	for _, highlighting := range []string{"github", ""} {
+		options := DefaultOptions()
+		options.SourcePos = true
+		options.Highlighting = highlighting
+		c, err := New(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := c.Convert(context.Background(), []byte(markdown))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{
+			`<h1 id="a" data-sourcepos="1:1-1:3">`,
+			"<div data-sourcepos=\"3:1-5:3\">\n<pre",
+			"<div data-sourcepos=\"7:5-7:8\">\n<pre><code>code\n</code></pre>\n</div>",
+		} {
+			if !strings.Contains(res.HTML, s) {
+				t.Errorf("highlighting %q: html does not contain %q:\n%s", highlighting, s, res.HTML)
+			}
+		}
+	}
+}
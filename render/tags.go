@@ -0,0 +1,103 @@
+package render
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// inlineTag is an inline element delimited by a repeated character, like ==mark== or ^sup^.
+// It is parsed like the goldmark strikethrough extension.
+type inlineTag struct {
+	char   byte
+	length int
+	tag    string
+	kind   ast.NodeKind
+}
+
+// the available inline tags
+var (
+	subTag  = &inlineTag{char: '~', length: 1, tag: "sub", kind: ast.NewNodeKind("Subscript")}
+	supTag  = &inlineTag{char: '^', length: 1, tag: "sup", kind: ast.NewNodeKind("Superscript")}
+	markTag = &inlineTag{char: '=', length: 2, tag: "mark", kind: ast.NewNodeKind("Mark")}
+	insTag  = &inlineTag{char: '+', length: 2, tag: "ins", kind: ast.NewNodeKind("Ins")}
+)
+
+// tagNode is the ast node of an inline tag.
+type tagNode struct {
+	ast.BaseInline
+	tag *inlineTag
+}
+
+// Kind implements ast.Node.Kind.
+func (n *tagNode) Kind() ast.NodeKind {
+	return n.tag.kind
+}
+
+// Dump implements ast.Node.Dump.
+func (n *tagNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// IsDelimiter implements parser.DelimiterProcessor.IsDelimiter.
+func (t *inlineTag) IsDelimiter(b byte) bool {
+	return b == t.char
+}
+
+// CanOpenCloser implements parser.DelimiterProcessor.CanOpenCloser.
+func (t *inlineTag) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char && opener.OriginalLength == closer.OriginalLength
+}
+
+// OnMatch implements parser.DelimiterProcessor.OnMatch.
+func (t *inlineTag) OnMatch(consumes int) ast.Node {
+	return &tagNode{tag: t}
+}
+
+// Trigger implements parser.InlineParser.Trigger.
+func (t *inlineTag) Trigger() []byte {
+	return []byte{t.char}
+}
+
+// Parse implements parser.InlineParser.Parse.
+// Only the delimiters with the exact length are accepted.
+func (t *inlineTag) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, t.length, t)
+	if node == nil || node.OriginalLength != t.length || before == rune(t.char) {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (t *inlineTag) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(t.kind, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_ = w.WriteByte('<')
+			_, _ = w.WriteString(t.tag)
+			if n.Attributes() != nil {
+				html.RenderAttributes(w, n, html.GlobalAttributeFilter)
+			}
+			_ = w.WriteByte('>')
+		} else {
+			_, _ = w.WriteString("</" + t.tag + ">")
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// Extend implements goldmark.Extender.
+// The priority is higher than the strikethrough one, so that ~sub~ is not striked through.
+func (t *inlineTag) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(t, 450)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(t, 450)))
+}
@@ -0,0 +1,204 @@
+package render
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// TOCItem is a heading in the table of contents.
+type TOCItem struct {
+	Level int
+	ID    string
+	Title template.HTML
+	Items []*TOCItem
+}
+
+// TOC is the table of contents of a document, available as `.toc` in the template.
+type TOC struct {
+	HTML  template.HTML
+	Items []*TOCItem
+}
+
+// tocKey is used to store the table of contents in the parser context
+var tocKey = parser.NewContextKey()
+
+// tocMarkers are the paragraphs replaced by the table of contents
+var tocMarkers = []string{"[TOC]", "[[_TOC_]]"}
+
+// kindTOC is the kind of the table of contents node
+var kindTOC = ast.NewNodeKind("TOC")
+
+// tocNode is the block replacing the toc markers.
+type tocNode struct {
+	ast.BaseBlock
+	html []byte
+}
+
+// Kind implements ast.Node.Kind.
+func (n *tocNode) Kind() ast.NodeKind {
+	return kindTOC
+}
+
+// Dump implements ast.Node.Dump.
+func (n *tocNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// tocTransformer collects the headings (with level between min and max)
+// and replaces the toc markers with the resulting list.
+type tocTransformer struct {
+	min, max int
+}
+
+// Transform implements parser.ASTTransformer.
+func (t *tocTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var items []*TOCItem
+	var stack []*TOCItem
+	var markers []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			if n.Level < t.min || n.Level > t.max {
+				return ast.WalkSkipChildren, nil
+			}
+			item := &TOCItem{Level: n.Level, Title: template.HTML(InlineHTML(n, source))}
+			if id, ok := n.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					item.ID = string(b)
+				}
+			}
+			// the parent is the last item with lower level
+			for len(stack) > 0 && stack[len(stack)-1].Level >= item.Level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				items = append(items, item)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Items = append(parent.Items, item)
+			}
+			stack = append(stack, item)
+			return ast.WalkSkipChildren, nil
+		case *ast.Paragraph:
+			if isTOCMarker(n, source) {
+				markers = append(markers, n)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	toc := &TOC{Items: items}
+	if len(items) > 0 {
+		var buf bytes.Buffer
+		buf.WriteString("<nav class=\"toc\">\n")
+		writeTOCList(&buf, items)
+		buf.WriteString("</nav>\n")
+		toc.HTML = template.HTML(buf.String())
+	}
+	pc.Set(tocKey, toc)
+
+	for _, p := range markers {
+		p.Parent().ReplaceChild(p.Parent(), p, &tocNode{html: []byte(toc.HTML)})
+	}
+}
+
+// isTOCMarker checks if the paragraph contains only a toc marker.
+func isTOCMarker(p *ast.Paragraph, source []byte) bool {
+	if p.Lines().Len() != 1 {
+		return false
+	}
+	segment := p.Lines().At(0)
+	line := strings.TrimSpace(string(segment.Value(source)))
+	for _, marker := range tocMarkers {
+		if line == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// InlineHTML returns the text content of the node as html (without the inline tags).
+func InlineHTML(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.WriteString(template.HTMLEscapeString(string(c.Segment.Value(source))))
+			if c.SoftLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			if c.IsCode() || c.IsRaw() {
+				// already html (like typographic entities)
+				b.Write(c.Value)
+			} else {
+				b.WriteString(template.HTMLEscapeString(string(c.Value)))
+			}
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// writeTOCList writes the nested items as html list.
+func writeTOCList(buf *bytes.Buffer, items []*TOCItem) {
+	buf.WriteString("<ul>\n")
+	for _, item := range items {
+		buf.WriteString("<li>")
+		if item.ID != "" {
+			buf.WriteString(`<a href="#` + template.HTMLEscapeString(item.ID) + `">`)
+			buf.WriteString(string(item.Title))
+			buf.WriteString("</a>")
+		} else {
+			buf.WriteString(string(item.Title))
+		}
+		if len(item.Items) > 0 {
+			buf.WriteString("\n")
+			writeTOCList(buf, item.Items)
+		}
+		buf.WriteString("</li>\n")
+	}
+	buf.WriteString("</ul>\n")
+}
+
+// tocRenderer renders the toc nodes.
+type tocRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer.RegisterFuncs.
+func (r *tocRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindTOC, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.Write(n.(*tocNode).html)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// tocExtension collects the table of contents and replaces the toc markers.
+type tocExtension struct {
+	min, max int
+}
+
+// Extend implements goldmark.Extender.
+func (e *tocExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&tocTransformer{min: e.min, max: e.max}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&tocRenderer{}, 100)))
+}